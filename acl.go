@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+)
+
+// ipACL 基于 CIDR 的客户端 IP 访问控制，拒绝列表优先于允许列表
+type ipACL struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// activeACL 当前生效的访问控制列表，配置重载时整体替换
+var activeACL atomic.Pointer[ipACL]
+
+// newIPACL 解析允许/拒绝列表
+func newIPACL(allow, deny []string) (*ipACL, error) {
+	a := &ipACL{}
+	var err error
+	if a.allow, err = parseCIDRs(allow); err != nil {
+		return nil, err
+	}
+	if a.deny, err = parseCIDRs(deny); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// parseCIDRs 将 CIDR 列表解析为 net.IPNet，单个 IP 视为 /32 或 /128
+func parseCIDRs(list []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", s, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// containsIP 判断 IP 是否落在任意一个网段内
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// permits 判断客户端 IP 是否允许访问，允许列表为空表示允许所有
+func (a *ipACL) permits(ip string) bool {
+	if len(a.allow) == 0 && len(a.deny) == 0 {
+		return true
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return len(a.allow) == 0
+	}
+	if containsIP(a.deny, parsed) {
+		return false
+	}
+	return len(a.allow) == 0 || containsIP(a.allow, parsed)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// defaultACMECacheDir 未配置 ACMECacheDir 时保存证书的目录
+const defaultACMECacheDir = "/var/lib/goweb/acme"
+
+// acmeManager ACME 模式下的证书管理器，未配置 ACMEDomains 时为 nil
+var acmeManager *autocert.Manager
+
+// newACMEManager 创建只为 ACMEDomains 申请证书的 Let's Encrypt 管理器
+func newACMEManager(cfg Config) *autocert.Manager {
+	dir := cfg.ACMECacheDir
+	if dir == "" {
+		dir = defaultACMECacheDir
+	}
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.ACMEDomains...),
+		Cache:      autocert.DirCache(dir),
+		Email:      cfg.ACMEEmail,
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// pprofPrefix pprof 调试接口的路径前缀
+const pprofPrefix = "/debug/pprof/"
+
+// pprofHandler 提供 net/http/pprof 的各个接口，只在 EnablePprof 时由主处理函数调用
+var pprofHandler = func() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(pprofPrefix, pprof.Index)
+	mux.HandleFunc(pprofPrefix+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(pprofPrefix+"profile", pprof.Profile)
+	mux.HandleFunc(pprofPrefix+"symbol", pprof.Symbol)
+	mux.HandleFunc(pprofPrefix+"trace", pprof.Trace)
+	return mux
+}()
+
+// adminAuthorized 判断请求是否带有 Authorization: Bearer <AdminToken>，未配置 AdminToken 时始终为 false
+func (c Config) adminAuthorized(r *http.Request) bool {
+	if c.AdminToken == "" {
+		return false
+	}
+	auth := r.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return false
+	}
+	return secretEqual(strings.TrimSpace(auth[7:]), c.AdminToken)
+}
+
+// serveReload 处理管理接口的重载请求，与 SIGHUP 效果相同，结果以 JSON 返回
+func serveReload(w http.ResponseWriter, r *http.Request, clientIP string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, `{"error": "method not allowed", "message": "Use POST to reload the config"}`)
+		return
+	}
+	log.Printf("Config reload requested by %s", clientIP)
+	if err := reloadConfig(); err != nil {
+		log.Println("Config reload failed, keeping current config:", err)
+		body, _ := json.Marshal(map[string]string{"error": "reload failed", "message": err.Error()})
+		writeJSON(w, http.StatusInternalServerError, string(body))
+		return
+	}
+	writeJSON(w, http.StatusOK, `{"status": "reloaded"}`)
+}
+
+// draining 实例正在下线：HealthPath 返回 503 让负载均衡器摘除，代理仍正常处理请求直到进程被停止
+var draining atomic.Bool
+
+// serveDrain 处理管理接口的下线请求：POST 进入 draining 状态，DELETE 取消（如部署回滚）
+func serveDrain(w http.ResponseWriter, r *http.Request, clientIP string) {
+	switch r.Method {
+	case http.MethodPost:
+		if !draining.Swap(true) {
+			log.Printf("Draining requested by %s, health check now reports unavailable", clientIP)
+		}
+		writeJSON(w, http.StatusOK, `{"status": "draining"}`)
+	case http.MethodDelete:
+		if draining.Swap(false) {
+			log.Printf("Draining cancelled by %s, health check reports ok again", clientIP)
+		}
+		writeJSON(w, http.StatusOK, `{"status": "ok"}`)
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		writeJSON(w, http.StatusMethodNotAllowed, `{"error": "method not allowed", "message": "Use POST to start draining or DELETE to cancel"}`)
+	}
+}
+
+// redacted 隐藏敏感值时使用的占位符
+const redacted = "[REDACTED]"
+
+// redactSecret 非空时返回占位符，空值保持为空以便区分是否配置
+func redactSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// redactHeaderValues 返回值都被隐藏的请求头副本，nil 保持为 nil
+func redactHeaderValues(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+	out := make(map[string]string, len(headers))
+	for name, value := range headers {
+		out[name] = redactSecret(value)
+	}
+	return out
+}
+
+// redactURL 隐藏地址中 user:password@ 的密码部分
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return s
+	}
+	return u.Redacted()
+}
+
+// redactedConfig 返回隐藏了请求头标识、密码、令牌等敏感字段的配置副本，切片和 map 都重新分配，不影响生效的配置
+func (c Config) redactedConfig() Config {
+	c.CfHeader = redactSecret(c.CfHeader)
+	if c.CfHeaders != nil {
+		c.CfHeaders = make([]string, len(c.CfHeaders))
+		for i := range c.CfHeaders {
+			c.CfHeaders[i] = redacted
+		}
+	}
+	c.BasicAuthPass = redactSecret(c.BasicAuthPass)
+	c.AdminToken = redactSecret(c.AdminToken)
+	c.JWTAuth.Secret = redactSecret(c.JWTAuth.Secret)
+	// 附加的请求头/响应头常用来携带上游凭据（如固定的 Authorization），值全部隐藏，只保留名称
+	c.AddRequestHeaders = redactHeaderValues(c.AddRequestHeaders)
+	c.AddResponseHeaders = redactHeaderValues(c.AddResponseHeaders)
+
+	c.RpAddr = redactURL(c.RpAddr)
+	c.RpAddrBackup = redactURL(c.RpAddrBackup)
+	c.CanaryTarget = redactURL(c.CanaryTarget)
+	c.OTLPEndpoint = redactURL(c.OTLPEndpoint)
+	if c.RpAddrs != nil {
+		addrs := make([]string, len(c.RpAddrs))
+		for i, addr := range c.RpAddrs {
+			addrs[i] = redactURL(addr)
+		}
+		c.RpAddrs = addrs
+	}
+	if c.RpTargets != nil {
+		targets := make([]WeightedTarget, len(c.RpTargets))
+		for i, t := range c.RpTargets {
+			t.Addr = redactURL(t.Addr)
+			targets[i] = t
+		}
+		c.RpTargets = targets
+	}
+	if c.Routes != nil {
+		routes := make([]Route, len(c.Routes))
+		for i, route := range c.Routes {
+			route.CfHeader = redactSecret(route.CfHeader)
+			route.Target = redactURL(route.Target)
+			routes[i] = route
+		}
+		c.Routes = routes
+	}
+	if c.Hosts != nil {
+		hosts := make(map[string]string, len(c.Hosts))
+		for host, target := range c.Hosts {
+			hosts[host] = redactURL(target)
+		}
+		c.Hosts = hosts
+	}
+	return c
+}
+
+// serveConfig 处理管理接口的配置查询，返回当前生效（含重载后）的配置，敏感字段已隐藏
+func serveConfig(w http.ResponseWriter, r *http.Request, cfg Config) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSON(w, http.StatusMethodNotAllowed, `{"error": "method not allowed", "message": "Use GET to inspect the config"}`)
+		return
+	}
+	body, err := json.MarshalIndent(cfg.redactedConfig(), "", "  ")
+	if err != nil {
+		log.Println("Failed to encode config:", err)
+		writeJSON(w, http.StatusInternalServerError, `{"error": "internal server error", "message": "Failed to encode the config"}`)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, string(body))
+}
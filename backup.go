@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+)
+
+// backupTransport 主上游不可用（连接失败、熔断或超时）时，把幂等请求改发到 RpAddrBackup 一次
+// 位于重试和熔断之外，主上游的重试全部失败后才切换
+type backupTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip 实现 http.RoundTripper，未配置 RpAddrBackup 时直接转发
+func (t *backupTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	cfg := loadConfig()
+	if err == nil || cfg.RpAddrBackup == "" || !isIdempotent(req.Method) || req.Context().Err() != nil {
+		return resp, err
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return resp, err
+	}
+	backup, perr := parseTarget(cfg.RpAddrBackup)
+	if perr != nil || backup.Host == req.URL.Host {
+		return resp, err
+	}
+
+	// 只替换协议和主机，路径已由 Director 按主上游改写
+	out := req.Clone(req.Context())
+	out.URL.Scheme = backup.Scheme
+	out.URL.Host = backup.Host
+	if !cfg.PreserveHost {
+		out.Host = upstreamHost(backup)
+	}
+	log.Printf("Upstream %s failed for %s: %v, retrying against backup %s", req.URL.Host, req.URL.Path, err, backup.Host)
+	resp, err = t.next.RoundTrip(out)
+	if err == nil {
+		log.Printf("Request %s served by backup %s", req.URL.Path, backup.Host)
+	}
+	return resp, err
+}
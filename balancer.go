@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"sync/atomic"
+)
+
+// WeightedTarget 带权重的代理目标，权重越大分到的请求越多
+type WeightedTarget struct {
+	Addr   string `json:"Addr"`   // 转发目标地址
+	Weight int    `json:"Weight"` // 权重，0 按 1 处理
+}
+
+// backend 表示一个反向代理目标
+type backend struct {
+	target   *url.URL
+	director func(*http.Request) // 复用标准库单目标代理的请求改写逻辑
+	path     string              // 路由规则的匹配路径，StripPrefix 时从请求路径中去掉
+	down     atomic.Bool         // 被健康检查标记为不可用
+	fails    atomic.Int32        // 连续探测失败次数
+	passed   atomic.Bool         // 至少通过过一次健康检查
+	weight   int                 // 加权轮询的权重
+	current  int                 // 平滑加权轮询的当前值，由 balancer.mu 保护
+}
+
+// newBackend 解析目标地址并创建代理目标
+func newBackend(addr string) (*backend, error) {
+	target, err := parseTarget(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &backend{
+		target:   target,
+		director: httputil.NewSingleHostReverseProxy(target).Director,
+	}, nil
+}
+
+// balancer 在多个目标之间轮询分发请求，权重不同时使用平滑加权轮询
+type balancer struct {
+	backends []*backend
+	counter  uint64 // 轮询计数器，使用原子操作保证并发安全
+
+	weighted bool       // 目标权重不全相同
+	mu       sync.Mutex // 保护加权轮询的 current
+
+	ring hashRing // 一致性哈希环，Stickiness 为 consistent-hash 时使用
+}
+
+// activeBalancer 当前生效的负载均衡器，配置重载时整体替换
+var activeBalancer atomic.Pointer[balancer]
+
+// newBalancer 解析目标地址列表并创建负载均衡器
+func newBalancer(targets []WeightedTarget) (*balancer, error) {
+	b := &balancer{}
+	for _, t := range targets {
+		be, err := newBackend(t.Addr)
+		if err != nil {
+			return nil, err
+		}
+		be.weight = t.Weight
+		if be.weight < 1 {
+			be.weight = 1
+		}
+		if len(b.backends) > 0 && be.weight != b.backends[0].weight {
+			b.weighted = true
+		}
+		b.backends = append(b.backends, be)
+	}
+	if len(b.backends) == 0 {
+		return nil, errors.New("no proxy target configured")
+	}
+	b.ring = newHashRing(b.backends)
+	return b, nil
+}
+
+// next 按轮询顺序选出下一个目标，跳过被健康检查标记为不可用的目标
+// 全部不可用时仍按轮询转发，由上游错误处理返回 502
+func (b *balancer) next() *backend {
+	if b.weighted {
+		if be := b.nextWeighted(); be != nil {
+			return be
+		}
+	}
+	n := atomic.AddUint64(&b.counter, 1)
+	size := uint64(len(b.backends))
+	for i := uint64(0); i < size; i++ {
+		if be := b.backends[(n-1+i)%size]; !be.down.Load() {
+			return be
+		}
+	}
+	return b.backends[(n-1)%size]
+}
+
+// nextWeighted 平滑加权轮询（同 nginx）：每轮各目标的 current 加上自身权重，选出最大者后减去总权重
+// 权重 3:1 时分发顺序为 a a b a，不会连续集中到同一个目标；全部不可用时返回 nil
+func (b *balancer) nextWeighted() *backend {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var best *backend
+	total := 0
+	for _, be := range b.backends {
+		if be.down.Load() {
+			continue
+		}
+		be.current += be.weight
+		total += be.weight
+		if best == nil || be.current > best.current {
+			best = be
+		}
+	}
+	if best != nil {
+		best.current -= total
+	}
+	return best
+}
+
+// inheritHealth 沿用重载前相同目标的健康状态，避免重载后不可用的目标重新接收请求、ReadinessPath 重新等待探测
+func inheritHealth(backends, old []*backend) {
+	for _, be := range backends {
+		for _, prev := range old {
+			if be.target.String() == prev.target.String() {
+				be.down.Store(prev.down.Load())
+				be.fails.Store(prev.fails.Load())
+				be.passed.Store(prev.passed.Load())
+			}
+		}
+	}
+}
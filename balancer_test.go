@@ -0,0 +1,88 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// pickSequence 连续选择 n 次目标，返回目标主机名组成的序列
+func pickSequence(b *balancer, n int) string {
+	picks := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		picks = append(picks, b.next().target.Host)
+	}
+	return strings.Join(picks, " ")
+}
+
+func TestBalancerWeighted(t *testing.T) {
+	b, err := newBalancer([]WeightedTarget{
+		{Addr: "http://a", Weight: 3},
+		{Addr: "http://b", Weight: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 平滑加权轮询：3:1 时每轮为 a a b a，不会把 a 的请求连续集中在一起
+	if got, want := pickSequence(b, 8), "a a b a a a b a"; got != want {
+		t.Errorf("sequence = %q, want %q", got, want)
+	}
+}
+
+func TestBalancerSkipsDown(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []WeightedTarget
+		down    string
+		want    []string // 应该被选中的目标
+	}{
+		{
+			name:    "weighted",
+			targets: []WeightedTarget{{Addr: "http://a", Weight: 3}, {Addr: "http://b", Weight: 1}, {Addr: "http://c", Weight: 1}},
+			down:    "a",
+			want:    []string{"b", "c"},
+		},
+		{
+			name:    "round robin",
+			targets: []WeightedTarget{{Addr: "http://a"}, {Addr: "http://b"}, {Addr: "http://c"}},
+			down:    "b",
+			want:    []string{"a", "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := newBalancer(tt.targets)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, be := range b.backends {
+				be.down.Store(be.target.Host == tt.down)
+			}
+			seq := strings.Fields(pickSequence(b, 12))
+			for _, host := range seq {
+				if host == tt.down {
+					t.Fatalf("sequence %v contains down backend %q", seq, tt.down)
+				}
+			}
+			for _, want := range tt.want {
+				if !slices.Contains(seq, want) {
+					t.Errorf("sequence %v never picks %q", seq, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBalancerAllDown(t *testing.T) {
+	b, err := newBalancer([]WeightedTarget{{Addr: "http://a", Weight: 3}, {Addr: "http://b", Weight: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, be := range b.backends {
+		be.down.Store(true)
+	}
+	// 全部不可用时仍按轮询转发，由上游错误处理返回 502
+	if got, want := pickSequence(b, 4), "a b a b"; got != want {
+		t.Errorf("sequence = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 熔断器默认参数
+const (
+	defaultBreakerWindow   = 10 * time.Second
+	defaultBreakerCooldown = 30 * time.Second
+)
+
+// errCircuitOpen 熔断期间直接拒绝请求，不再连接上游
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+// serviceUnavailableBody 熔断期间返回的内容
+const serviceUnavailableBody = `{"error": "service unavailable", "message": "The upstream is temporarily unavailable, please retry later"}`
+
+// breakerState 熔断器状态
+type breakerState int
+
+const (
+	breakerClosed   breakerState = iota // 正常转发
+	breakerOpen                         // 熔断中，直接失败
+	breakerHalfOpen                     // 冷却结束，放行一个试探请求
+)
+
+// circuitBreaker 单个上游地址的熔断状态
+type circuitBreaker struct {
+	mu           sync.Mutex
+	state        breakerState
+	failures     int       // 窗口内连续失败次数
+	firstFailure time.Time // 本轮连续失败的开始时间
+	openedAt     time.Time
+	probing      bool // 半开状态下是否已有试探请求在进行
+}
+
+// allow 判断请求是否可以发往上游，冷却结束后转为半开并只放行一个请求
+func (b *circuitBreaker) allow(cooldown time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// record 记录一次请求结果，返回状态是否发生变化以便记录日志
+func (b *circuitBreaker) record(ok bool, threshold int, window time.Duration) (breakerState, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	prev := b.state
+	b.probing = false
+
+	if ok {
+		b.state = breakerClosed
+		b.failures = 0
+		return b.state, prev != b.state
+	}
+
+	now := time.Now()
+	if b.failures == 0 || now.Sub(b.firstFailure) > window {
+		b.failures = 0
+		b.firstFailure = now
+	}
+	b.failures++
+	// 半开状态下试探失败立即重新熔断
+	if b.state == breakerHalfOpen || b.failures >= threshold {
+		b.state = breakerOpen
+		b.openedAt = now
+		b.failures = 0
+	}
+	return b.state, prev != b.state
+}
+
+// release 结束一次不计结果的请求（如客户端断开），只清除试探标记，半开状态下下一个请求可以继续试探
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// breakerTransport 按上游地址熔断：窗口内连续失败达到阈值后在冷却期内直接返回 errCircuitOpen
+type breakerTransport struct {
+	next     http.RoundTripper
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+// get 返回指定上游地址的熔断器，不存在时创建
+func (t *breakerTransport) get(host string) *circuitBreaker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.breakers == nil {
+		t.breakers = make(map[string]*circuitBreaker)
+	}
+	b, ok := t.breakers[host]
+	if !ok {
+		b = &circuitBreaker{}
+		t.breakers[host] = b
+	}
+	return b
+}
+
+// RoundTrip 实现 http.RoundTripper，CircuitBreakerFailures 为 0 时不启用
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	cfg := loadConfig()
+	if cfg.CircuitBreakerFailures <= 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	b := t.get(req.URL.Host)
+	if !b.allow(cfg.CircuitBreakerCooldown.or(defaultBreakerCooldown)) {
+		return nil, errCircuitOpen
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	// 客户端主动断开或 HandlerTimeout 取消不算上游故障，但要释放半开状态的试探名额
+	if err != nil && req.Context().Err() != nil {
+		b.release()
+		return resp, err
+	}
+	state, changed := b.record(err == nil, cfg.CircuitBreakerFailures, cfg.CircuitBreakerWindow.or(defaultBreakerWindow))
+	if changed {
+		switch state {
+		case breakerOpen:
+			log.Printf("Circuit breaker for %s opened", req.URL.Host)
+		case breakerClosed:
+			log.Printf("Circuit breaker for %s closed", req.URL.Host)
+		}
+	}
+	return resp, err
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// roundTripperFunc 用函数实现 http.RoundTripper，模拟上游的返回
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// setTestConfig 替换全局配置，测试结束后恢复
+func setTestConfig(t *testing.T, cfg Config) {
+	t.Helper()
+	configMu.Lock()
+	prev := config
+	config = cfg
+	configMu.Unlock()
+	t.Cleanup(func() {
+		configMu.Lock()
+		config = prev
+		configMu.Unlock()
+	})
+}
+
+func TestBreakerCanceledProbeReleasesHalfOpen(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+	setTestConfig(t, Config{CircuitBreakerFailures: 1, CircuitBreakerCooldown: Duration(cooldown)})
+
+	errUpstream := errors.New("connection refused")
+	calls := 0
+	bt := &breakerTransport{next: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		calls++
+		if err := r.Context().Err(); err != nil {
+			return nil, err
+		}
+		return nil, errUpstream
+	})}
+
+	// 一次失败即熔断
+	if _, err := bt.RoundTrip(httptest.NewRequest("GET", "http://upstream/", nil)); err != errUpstream {
+		t.Fatalf("first request error = %v, want upstream error", err)
+	}
+	if _, err := bt.RoundTrip(httptest.NewRequest("GET", "http://upstream/", nil)); err != errCircuitOpen {
+		t.Fatalf("request during cooldown error = %v, want errCircuitOpen", err)
+	}
+
+	// 冷却结束后的试探请求被客户端取消
+	time.Sleep(cooldown)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	probe := httptest.NewRequest("GET", "http://upstream/", nil).WithContext(ctx)
+	if _, err := bt.RoundTrip(probe); !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled probe error = %v, want context.Canceled", err)
+	}
+
+	// 取消的试探不能一直占用名额，下一个请求应该被放行到上游
+	before := calls
+	if _, err := bt.RoundTrip(httptest.NewRequest("GET", "http://upstream/", nil)); err == errCircuitOpen {
+		t.Fatal("request after canceled probe was rejected by the breaker")
+	}
+	if calls != before+1 {
+		t.Fatalf("upstream calls = %d, want %d", calls, before+1)
+	}
+}
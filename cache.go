@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCacheEntryBytes 单个缓存响应体的大小上限，超过的响应不缓存
+const maxCacheEntryBytes = 1 << 20
+
+// cacheStatusHeader 返回给客户端的缓存状态：HIT、MISS 或 BYPASS，访问日志也从这里读取
+const cacheStatusHeader = "X-Cache"
+
+// cacheEntry 一条缓存的上游响应
+type cacheEntry struct {
+	key     string
+	status  int
+	header  http.Header // 只包含上游返回的响应头，不含本服务为每个请求添加的请求 ID、CORS 等
+	body    []byte
+	stored  time.Time
+	expires time.Time
+}
+
+// responseCache 按最近最少使用淘汰的响应缓存
+type responseCache struct {
+	mu      sync.Mutex
+	ll      *list.List // 表头为最近使用的条目
+	entries map[string]*list.Element
+}
+
+// proxyCache 代理响应缓存，容量由 CacheMaxEntries 决定
+var proxyCache = &responseCache{ll: list.New(), entries: make(map[string]*list.Element)}
+
+// get 返回未过期的缓存条目，过期条目顺便删除
+func (c *responseCache) get(key string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	e := el.Value.(*cacheEntry)
+	if time.Now().After(e.expires) {
+		c.ll.Remove(el)
+		delete(c.entries, key)
+		return nil
+	}
+	c.ll.MoveToFront(el)
+	return e
+}
+
+// add 写入缓存条目，超出容量时淘汰最久未使用的条目
+func (c *responseCache) add(e *cacheEntry, maxEntries int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[e.key]; ok {
+		el.Value = e
+		c.ll.MoveToFront(el)
+	} else {
+		c.entries[e.key] = c.ll.PushFront(e)
+	}
+	for c.ll.Len() > maxEntries {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// cacheKey 缓存键：方法、主机、路径和查询参数；上游可能按 Accept-Encoding 返回压缩内容，也计入键中
+// 请求已选定目标（如金丝雀）时目标也计入键中，不同目标的响应不会互相命中
+func cacheKey(r *http.Request) string {
+	key := r.Method + " " + r.Host + r.URL.RequestURI() + " " + r.Header.Get("Accept-Encoding")
+	if b := selectedBackend(r); b != nil {
+		key += " " + b.target.String()
+	}
+	return key
+}
+
+// cacheTTL 根据上游响应头计算缓存时间，返回 0 表示不缓存
+// 遵循 Cache-Control（s-maxage 优先于 max-age，no-store/no-cache/private 不缓存），没有指定时使用 def；
+// 带 Set-Cookie、按其他请求头区分内容（Vary）的响应不缓存；带认证信息的请求只有 public 或 s-maxage 时才缓存
+func cacheTTL(h http.Header, authorized bool, def time.Duration) time.Duration {
+	if h.Get("Set-Cookie") != "" {
+		return 0
+	}
+	if v := strings.TrimSpace(h.Get("Vary")); v != "" && !strings.EqualFold(v, "Accept-Encoding") {
+		return 0
+	}
+
+	ttl := def
+	public, shared := false, false
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache", "private":
+			return 0
+		case "public":
+			public = true
+		case "max-age":
+			if n, err := strconv.Atoi(value); err == nil && !shared {
+				ttl = time.Duration(n) * time.Second
+			}
+		case "s-maxage":
+			if n, err := strconv.Atoi(value); err == nil {
+				ttl = time.Duration(n) * time.Second
+				shared = true
+			}
+		}
+	}
+	if authorized && !public && !shared {
+		return 0
+	}
+	return ttl
+}
+
+// write 将缓存的响应写给客户端
+func (e *cacheEntry) write(w http.ResponseWriter) {
+	h := w.Header()
+	for k, vv := range e.header {
+		for _, v := range vv {
+			h.Add(k, v)
+		}
+	}
+	h.Set("Age", strconv.Itoa(int(time.Since(e.stored).Seconds())))
+	h.Set(cacheStatusHeader, "HIT")
+	w.WriteHeader(e.status)
+	w.Write(e.body)
+}
+
+// cacheHandler 对 GET 请求使用响应缓存，CacheMaxEntries 为 0 时直接转发
+// 客户端带 Cache-Control: no-cache（或 Pragma: no-cache）时跳过缓存读取但会用新响应更新缓存，no-store 时完全不使用缓存
+func cacheHandler(cfg Config, w http.ResponseWriter, r *http.Request, next http.Handler) {
+	if cfg.CacheMaxEntries <= 0 || r.Method != http.MethodGet || isWebSocketUpgrade(r) {
+		next.ServeHTTP(w, r)
+		return
+	}
+	cc := strings.ToLower(r.Header.Get("Cache-Control"))
+	if strings.Contains(cc, "no-store") {
+		w.Header().Set(cacheStatusHeader, "BYPASS")
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	key := cacheKey(r)
+	if strings.Contains(cc, "no-cache") || r.Header.Get("Pragma") == "no-cache" {
+		w.Header().Set(cacheStatusHeader, "BYPASS")
+	} else if e := proxyCache.get(key); e != nil {
+		e.write(w)
+		return
+	} else {
+		w.Header().Set(cacheStatusHeader, "MISS")
+	}
+
+	cw := &cacheWriter{ResponseWriter: w, header: make(http.Header)}
+	next.ServeHTTP(cw, r)
+
+	if cw.status != http.StatusOK || cw.tooLarge {
+		return
+	}
+	ttl := cacheTTL(cw.header, r.Header.Get("Authorization") != "", time.Duration(cfg.CacheDefaultTTL))
+	if ttl <= 0 {
+		return
+	}
+	now := time.Now()
+	proxyCache.add(&cacheEntry{
+		key:     key,
+		status:  cw.status,
+		header:  cw.header,
+		body:    cw.body.Bytes(),
+		stored:  now,
+		expires: now.Add(ttl),
+	}, cfg.CacheMaxEntries)
+}
+
+// cacheWriter 记录上游响应以便写入缓存，响应头单独保存，写出时再合并到客户端响应
+type cacheWriter struct {
+	http.ResponseWriter
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	tooLarge bool
+}
+
+func (cw *cacheWriter) Header() http.Header {
+	return cw.header
+}
+
+func (cw *cacheWriter) WriteHeader(code int) {
+	h := cw.ResponseWriter.Header()
+	for k, vv := range cw.header {
+		for _, v := range vv {
+			h.Add(k, v)
+		}
+	}
+	if code >= 200 && cw.status == 0 {
+		cw.status = code
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *cacheWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.tooLarge {
+		if cw.body.Len()+len(p) > maxCacheEntryBytes {
+			cw.tooLarge = true
+			cw.body = bytes.Buffer{}
+		} else {
+			cw.body.Write(p)
+		}
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Unwrap 让 http.ResponseController 能拿到底层的 ResponseWriter
+func (cw *cacheWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+)
+
+// defaultCanaryHeaderValue 未配置 CanaryHeaderValue 时选择金丝雀目标的请求头值
+const defaultCanaryHeaderValue = "true"
+
+// 访问日志中记录的版本
+const (
+	variantStable = "stable"
+	variantCanary = "canary"
+)
+
+// activeCanary 当前生效的金丝雀目标，未配置 CanaryTarget 时为 nil
+var activeCanary atomic.Pointer[backend]
+
+// newCanaryBackend 解析金丝雀目标地址，为空时返回 nil
+func newCanaryBackend(target string) (*backend, error) {
+	if target == "" {
+		return nil, nil
+	}
+	return newBackend(target)
+}
+
+// canaryRequested 判断请求是否转发到金丝雀目标：客户端通过 CanaryHeader 主动选择，或按 CanaryPercent 随机分流
+func (c Config) canaryRequested(r *http.Request) bool {
+	if c.CanaryPercent > 0 && rand.Float64()*100 < c.CanaryPercent {
+		return true
+	}
+	if c.CanaryHeader == "" {
+		return false
+	}
+	value := c.CanaryHeaderValue
+	if value == "" {
+		value = defaultCanaryHeaderValue
+	}
+	return r.Header.Get(c.CanaryHeader) == value
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultCertCheckInterval 未配置 CertCheckInterval 时检查证书文件的间隔
+const defaultCertCheckInterval = time.Minute
+
+// certCache 缓存从磁盘加载的证书，文件被替换（如 certbot 续期）后自动重新加载
+type certCache struct {
+	certFile string
+	keyFile  string
+	interval time.Duration // 两次检查文件修改时间的最小间隔
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time // 当前证书对应的文件修改时间
+	checked time.Time // 上次检查文件的时间
+}
+
+// newCertCache 加载证书并创建缓存，首次加载失败直接返回错误
+func newCertCache(certFile, keyFile string, interval time.Duration) (*certCache, error) {
+	c := &certCache{certFile: certFile, keyFile: keyFile, interval: interval}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// load 从磁盘读取证书和私钥，调用方需持有锁或处于初始化阶段
+func (c *certCache) load() error {
+	modTime, err := c.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	c.cert = &cert
+	c.modTime = modTime
+	c.checked = time.Now()
+	return nil
+}
+
+// latestModTime 返回证书和私钥文件中较新的修改时间
+func (c *certCache) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{c.certFile, c.keyFile} {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return latest, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// getCertificate 实现 tls.Config.GetCertificate，文件有更新时重新加载
+// 重新加载失败时继续使用旧证书，避免续期过程中的中间状态导致握手失败
+func (c *certCache) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.checked) < c.interval {
+		return c.cert, nil
+	}
+	c.checked = time.Now()
+
+	modTime, err := c.latestModTime()
+	if err != nil {
+		log.Println("Failed to stat certificate files:", err)
+		return c.cert, nil
+	}
+	if modTime.Equal(c.modTime) {
+		return c.cert, nil
+	}
+	if err := c.load(); err != nil {
+		log.Println("Failed to reload certificate, keeping current one:", err)
+		return c.cert, nil
+	}
+	log.Println("Certificate reloaded from", c.certFile)
+	return c.cert, nil
+}
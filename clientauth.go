@@ -0,0 +1,37 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// loadClientAuth 根据 ClientCAFile/RequireClientCert 返回客户端证书校验设置
+// 只配置 CA 时校验客户端主动提供的证书；RequireClientCert 为 true 时拒绝未携带有效证书的握手
+func loadClientAuth(cfg Config) (*x509.CertPool, tls.ClientAuthType, error) {
+	if cfg.ClientCAFile == "" {
+		return nil, tls.NoClientCert, nil
+	}
+	pem, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, tls.NoClientCert, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, tls.NoClientCert, fmt.Errorf("no valid certificates found in %s", cfg.ClientCAFile)
+	}
+	if cfg.RequireClientCert {
+		return pool, tls.RequireAndVerifyClientCert, nil
+	}
+	return pool, tls.VerifyClientCertIfGiven, nil
+}
+
+// clientCertCN 返回已验证的客户端证书主题 CN，没有证书时返回空字符串
+func clientCertCN(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	return r.TLS.PeerCertificates[0].Subject.CommonName
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// CompressionConfig 响应压缩配置
+type CompressionConfig struct {
+	Enabled      bool     `json:"Enabled"`      // 是否压缩代理返回的响应
+	Brotli       bool     `json:"Brotli"`       // 客户端支持时优先使用 brotli，否则只用 gzip
+	MinSize      int      `json:"MinSize"`      // 小于该字节数的响应不压缩，默认 1024
+	ContentTypes []string `json:"ContentTypes"` // 允许压缩的内容类型，支持 "text/*" 通配，默认常见文本类型
+}
+
+// defaultCompressMinSize 未配置 MinSize 时的压缩阈值
+const defaultCompressMinSize = 1024
+
+// defaultCompressTypes 未配置 ContentTypes 时允许压缩的内容类型
+var defaultCompressTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+}
+
+// minSize 返回压缩阈值
+func (c CompressionConfig) minSize() int {
+	if c.MinSize <= 0 {
+		return defaultCompressMinSize
+	}
+	return c.MinSize
+}
+
+// compressible 判断内容类型是否在允许列表中
+func (c CompressionConfig) compressible(contentType string) bool {
+	types := c.ContentTypes
+	if len(types) == 0 {
+		types = defaultCompressTypes
+	}
+	return matchContentType(types, contentType)
+}
+
+// matchContentType 判断内容类型是否在列表中，"text/*" 匹配所有 text 子类型
+func matchContentType(types []string, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range types {
+		if t == mediaType || strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(t, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptedEncoding 根据 Accept-Encoding 选择压缩算法，不支持时返回空字符串
+func (c CompressionConfig) acceptedEncoding(r *http.Request) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	switch {
+	case c.Brotli && accepted["br"]:
+		return "br"
+	case accepted["gzip"]:
+		return "gzip"
+	}
+	return ""
+}
+
+// 压缩器内部的窗口和哈希表占用较大（gzip 约 1MB），按响应复用，避免每个响应重新分配
+var (
+	gzipWriterPool = sync.Pool{New: func() any {
+		gw, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+		return gw
+	}}
+	brotliWriterPool = sync.Pool{New: func() any { return brotli.NewWriter(io.Discard) }}
+)
+
+// compressWriter 按需压缩响应的 ResponseWriter
+// 响应头写出时判断：上游已压缩、类型不在允许列表或长度低于阈值时原样输出；
+// 长度未知时先缓冲到阈值大小再决定
+type compressWriter struct {
+	http.ResponseWriter
+	cfg      CompressionConfig
+	encoding string
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     io.WriteCloser // 为 nil 表示不压缩
+}
+
+// compressHandler 对支持压缩的客户端包装 ResponseWriter，WebSocket 和 HEAD 请求不处理
+func compressHandler(cfg CompressionConfig, w http.ResponseWriter, r *http.Request, next http.Handler) {
+	encoding := cfg.acceptedEncoding(r)
+	if !cfg.Enabled || encoding == "" || r.Method == http.MethodHead || isWebSocketUpgrade(r) {
+		next.ServeHTTP(w, r)
+		return
+	}
+	cw := &compressWriter{ResponseWriter: w, cfg: cfg, encoding: encoding}
+	defer cw.Close()
+	next.ServeHTTP(cw, r)
+}
+
+// WriteHeader 记录状态码，能确定不压缩时立即写出响应头
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.status != 0 {
+		return
+	}
+	cw.status = code
+
+	h := cw.Header()
+	if code < 200 || code == http.StatusNoContent || code == http.StatusNotModified ||
+		h.Get("Content-Encoding") != "" || !cw.cfg.compressible(h.Get("Content-Type")) {
+		cw.decide(false)
+		return
+	}
+	if n, err := strconv.Atoi(h.Get("Content-Length")); err == nil && n < cw.cfg.minSize() {
+		cw.decide(false)
+	}
+}
+
+// Write 未决定是否压缩时先缓冲，达到阈值后开始压缩输出
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) >= cw.cfg.minSize() {
+			cw.decide(true)
+		}
+		return len(p), nil
+	}
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// decide 写出响应头和已缓冲的内容，compress 为 true 时切换到压缩输出
+func (cw *compressWriter) decide(compress bool) {
+	cw.decided = true
+	h := cw.Header()
+	if compress {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding)
+		h.Add("Vary", "Accept-Encoding")
+		if cw.encoding == "br" {
+			bw := brotliWriterPool.Get().(*brotli.Writer)
+			bw.Reset(cw.ResponseWriter)
+			cw.enc = bw
+		} else {
+			gw := gzipWriterPool.Get().(*gzip.Writer)
+			gw.Reset(cw.ResponseWriter)
+			cw.enc = gw
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if len(cw.buf) > 0 {
+		if cw.enc != nil {
+			cw.enc.Write(cw.buf)
+		} else {
+			cw.ResponseWriter.Write(cw.buf)
+		}
+		cw.buf = nil
+	}
+}
+
+// Flush 流式响应需要立即输出，此时直接按响应头决定是否压缩
+func (cw *compressWriter) Flush() {
+	if cw.status == 0 {
+		return
+	}
+	if !cw.decided {
+		cw.decide(true)
+	}
+	if f, ok := cw.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Close 输出剩余缓冲内容并结束压缩流
+func (cw *compressWriter) Close() error {
+	if cw.status == 0 {
+		return nil
+	}
+	if !cw.decided {
+		cw.decide(false)
+	}
+	if cw.enc == nil {
+		return nil
+	}
+	err := cw.enc.Close()
+	switch enc := cw.enc.(type) {
+	case *gzip.Writer:
+		gzipWriterPool.Put(enc)
+	case *brotli.Writer:
+		brotliWriterPool.Put(enc)
+	}
+	cw.enc = nil
+	return err
+}
+
+// Unwrap 供 http.ResponseController 访问底层 ResponseWriter
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
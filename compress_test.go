@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// discardResponseWriter 丢弃响应内容，避免基准测试统计到 httptest.ResponseRecorder 的缓冲开销
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header         { return w.header }
+func (w *discardResponseWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *discardResponseWriter) WriteHeader(int)             {}
+
+func TestCompressHandlerReusesWriters(t *testing.T) {
+	body := strings.Repeat("hello gzip\n", 500)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, body)
+	})
+	// 压缩器从池中复用，连续多个响应都必须能完整解压
+	for i := 0; i < 3; i++ {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		compressHandler(CompressionConfig{Enabled: true}, w, r, next)
+		if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("response %d: Content-Encoding = %q, want gzip", i, got)
+		}
+		zr, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatalf("response %d: %v", i, err)
+		}
+		got, err := io.ReadAll(zr)
+		if err != nil || string(got) != body {
+			t.Fatalf("response %d: decoded %d bytes (err %v), want %d", i, len(got), err, len(body))
+		}
+	}
+}
+
+func BenchmarkCompressHandler(b *testing.B) {
+	for _, size := range []int{4 << 10, 64 << 10} {
+		body := bytes.Repeat([]byte(`{"id": 1, "name": "goweb", "tags": ["proxy", "gzip"]}`+"\n"), size/54+1)[:size]
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(body)
+		})
+		for _, bc := range []struct {
+			name     string
+			cfg      CompressionConfig
+			encoding string
+		}{
+			{"identity", CompressionConfig{Enabled: true}, ""},
+			{"gzip", CompressionConfig{Enabled: true}, "gzip"},
+			{"brotli", CompressionConfig{Enabled: true, Brotli: true}, "br"},
+		} {
+			b.Run(fmt.Sprintf("%s/%dKB", bc.name, size>>10), func(b *testing.B) {
+				r := httptest.NewRequest("GET", "/", nil)
+				if bc.encoding != "" {
+					r.Header.Set("Accept-Encoding", bc.encoding)
+				}
+				b.SetBytes(int64(size))
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					w := &discardResponseWriter{header: make(http.Header)}
+					compressHandler(bc.cfg, w, r, next)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// overloadedBody 并发请求数达到上限时返回的内容
+const overloadedBody = `{"error": "service unavailable", "message": "Too many requests in flight, please retry later"}`
+
+// semaphore 限制同时转发的请求数，容量即 MaxConcurrentRequests
+type semaphore chan struct{}
+
+// activeSemaphore 当前生效的并发限制，为 nil 表示不限制；上限变化时重载整体替换，已在处理的请求仍释放到原来的信号量
+var activeSemaphore atomic.Pointer[semaphore]
+
+// newSemaphore 创建容量为 n 的信号量，n 不大于 0 时返回 nil
+func newSemaphore(n int) *semaphore {
+	if n <= 0 {
+		return nil
+	}
+	s := make(semaphore, n)
+	return &s
+}
+
+// acquire 获取一个名额；已满时最多排队等待 wait，为 0 时立即失败，客户端断开也返回 false
+func (s *semaphore) acquire(ctx context.Context, wait time.Duration) bool {
+	select {
+	case *s <- struct{}{}:
+		return true
+	default:
+	}
+	if wait <= 0 {
+		return false
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case *s <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release 归还名额
+func (s *semaphore) release() {
+	<-*s
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// configFetchTimeout 从 URL 获取配置文件的超时时间
+const configFetchTimeout = 10 * time.Second
+
+// stdinConfigPath 表示从标准输入读取配置
+const stdinConfigPath = "-"
+
+// splitConfigPaths 拆分 -config 中逗号分隔的多个配置来源
+func splitConfigPaths(path string) []string {
+	var paths []string
+	for _, p := range strings.Split(path, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// readsStdin 判断配置来源中是否包含标准输入
+func readsStdin(path string) bool {
+	for _, p := range splitConfigPaths(path) {
+		if p == stdinConfigPath {
+			return true
+		}
+	}
+	return false
+}
+
+// isRemoteConfig 判断配置路径是否为 http(s):// 地址
+func isRemoteConfig(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// readConfigSource 读取配置内容，path 可以是本地文件、"-"（标准输入）或 http(s):// 地址
+// 本地文件不存在时返回的错误满足 os.IsNotExist
+func readConfigSource(path string) ([]byte, error) {
+	switch {
+	case path == stdinConfigPath:
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read Config from stdin: %w", err)
+		}
+		return data, nil
+	case isRemoteConfig(path):
+		return fetchConfig(path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("Failed to open Config file: %w", err)
+	}
+	defer file.Close() // 确保文件关闭
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read Config file: %w", err)
+	}
+	return data, nil
+}
+
+// fetchConfig 通过 HTTP(S) 获取配置内容，非 200 响应视为失败
+func fetchConfig(url string) ([]byte, error) {
+	client := &http.Client{Timeout: configFetchTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch Config: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to fetch Config from %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch Config: %w", err)
+	}
+	return data, nil
+}
+
+// mergeConfig 把 src 中的非零字段合并到 dst，用于合并多个配置来源：
+// 嵌套结构体逐字段合并，map 逐项合并，其他字段（包括数组）非零时整体替换。
+// 后面文件中的 ""、0、false 不会清除前面文件的值
+func mergeConfig(dst *Config, src Config) {
+	mergeNonZero(reflect.ValueOf(dst).Elem(), reflect.ValueOf(src))
+}
+
+// mergeNonZero 按 mergeConfig 的规则合并两个同类型结构体，未导出字段跳过
+func mergeNonZero(dst, src reflect.Value) {
+	for i := 0; i < dst.NumField(); i++ {
+		d, s := dst.Field(i), src.Field(i)
+		if !d.CanSet() || s.IsZero() {
+			continue
+		}
+		switch s.Kind() {
+		case reflect.Struct:
+			mergeNonZero(d, s)
+		case reflect.Map:
+			if d.IsNil() {
+				d.Set(reflect.MakeMapWithSize(s.Type(), s.Len()))
+			}
+			for iter := s.MapRange(); iter.Next(); {
+				d.SetMapIndex(iter.Key(), iter.Value())
+			}
+		default:
+			d.Set(s)
+		}
+	}
+}
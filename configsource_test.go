@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfigFile 把 JSON 内容写入临时目录中的文件，返回文件路径
+func writeConfigFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFileMergesNonZeroFields(t *testing.T) {
+	dir := t.TempDir()
+	base := writeConfigFile(t, dir, "base.json", `{
+		"RpAddr": "http://base:8080",
+		"RpPath": "/api",
+		"LogFile": "/var/log/goweb.log",
+		"DebugBodyLog": true,
+		"RpPaths": ["/a", "/b"],
+		"AddRequestHeaders": {"X-Env": "base", "X-Team": "web"},
+		"Compression": {"Enabled": true, "MinSize": 512}
+	}`)
+	prod := writeConfigFile(t, dir, "prod.json", `{
+		"RpAddr": "http://prod:8080",
+		"LogFile": "",
+		"DebugBodyLog": false,
+		"RpPaths": ["/c"],
+		"AddRequestHeaders": {"X-Env": "prod"},
+		"Compression": {"MinSize": 2048}
+	}`)
+
+	c, err := loadFile(base + "," + prod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.RpAddr != "http://prod:8080" {
+		t.Errorf("RpAddr = %q, want the later file's value", c.RpAddr)
+	}
+	// 后面文件中的空值和 false 不会清除前面的值
+	if c.LogFile != "/var/log/goweb.log" || c.RpPath != "/api" || !c.DebugBodyLog {
+		t.Errorf("LogFile = %q, RpPath = %q, DebugBodyLog = %v, want the base values kept", c.LogFile, c.RpPath, c.DebugBodyLog)
+	}
+	if strings.Join(c.RpPaths, ",") != "/c" {
+		t.Errorf("RpPaths = %v, want [/c] (arrays are replaced)", c.RpPaths)
+	}
+	if c.AddRequestHeaders["X-Env"] != "prod" || c.AddRequestHeaders["X-Team"] != "web" {
+		t.Errorf("AddRequestHeaders = %v, want entries merged", c.AddRequestHeaders)
+	}
+	if !c.Compression.Enabled || c.Compression.MinSize != 2048 {
+		t.Errorf("Compression = %+v, want fields merged", c.Compression)
+	}
+}
+
+func TestLoadFileMissingOverlay(t *testing.T) {
+	dir := t.TempDir()
+	base := writeConfigFile(t, dir, "base.json", `{"RpAddr": "http://base:8080"}`)
+	missing := filepath.Join(dir, "prdo.json")
+
+	_, err := loadFile(base + "," + missing)
+	if err == nil || !strings.Contains(err.Error(), "prdo.json") {
+		t.Fatalf("loadFile error = %v, want missing file reported", err)
+	}
+}
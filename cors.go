@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig 跨域资源共享配置
+type CORSConfig struct {
+	AllowedOrigins   []string `json:"AllowedOrigins"`   // 允许的来源，支持 "*" 和 "https://*.example.com" 通配，为空不启用 CORS
+	AllowedMethods   []string `json:"AllowedMethods"`   // 预检允许的请求方法，默认 GET、HEAD、POST
+	AllowedHeaders   []string `json:"AllowedHeaders"`   // 预检允许的请求头，为空时允许浏览器请求的所有请求头
+	AllowCredentials bool     `json:"AllowCredentials"` // 是否允许携带 Cookie 等凭据，不能与 "*" 来源同时使用
+	MaxAge           Duration `json:"MaxAge"`           // 浏览器缓存预检结果的时间，为空时由浏览器决定
+}
+
+// defaultCORSMethods 未配置 AllowedMethods 时预检允许的方法
+var defaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+
+// originAllowed 判断来源是否在允许列表中，"*" 匹配所有来源，"https://*.example.com" 匹配任意子域名
+func (c CORSConfig) originAllowed(origin string) bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		if prefix, suffix, ok := strings.Cut(allowed, "*"); ok {
+			if len(origin) > len(prefix)+len(suffix) &&
+				strings.HasPrefix(strings.ToLower(origin), strings.ToLower(prefix)) &&
+				strings.HasSuffix(strings.ToLower(origin), strings.ToLower(suffix)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setCORSHeaders 为允许的来源设置响应头，始终回显具体来源而不是 "*"，这样也能配合 AllowCredentials
+func setCORSHeaders(h http.Header, c CORSConfig, origin string) {
+	h.Set("Access-Control-Allow-Origin", origin)
+	h.Add("Vary", "Origin")
+	if c.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// isPreflight 判断是否为 CORS 预检请求
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// writePreflight 直接应答预检请求，不转发给上游
+func writePreflight(w http.ResponseWriter, r *http.Request, c CORSConfig) {
+	h := w.Header()
+	methods := c.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(c.AllowedHeaders) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(c.AllowedHeaders, ", "))
+	} else if req := r.Header.Get("Access-Control-Request-Headers"); req != "" {
+		h.Set("Access-Control-Allow-Headers", req)
+	}
+	if c.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(time.Duration(c.MaxAge).Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// stripUpstreamCORS 删除上游返回的 CORS 响应头，统一使用本服务设置的值，避免重复
+func stripUpstreamCORS(h http.Header) {
+	h.Del("Access-Control-Allow-Origin")
+	h.Del("Access-Control-Allow-Credentials")
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateCORSCredentials(t *testing.T) {
+	tests := []struct {
+		name    string
+		cors    CORSConfig
+		wantErr bool
+	}{
+		{"wildcard with credentials", CORSConfig{AllowedOrigins: []string{"https://app.example.com", "*"}, AllowCredentials: true}, true},
+		{"wildcard without credentials", CORSConfig{AllowedOrigins: []string{"*"}}, false},
+		{"explicit origins with credentials", CORSConfig{AllowedOrigins: []string{"https://*.example.com"}, AllowCredentials: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateConfig(Config{CORS: tt.cors})
+			got := err != nil && strings.Contains(err.Error(), "CORS.AllowCredentials")
+			if got != tt.wantErr {
+				t.Errorf("validateConfig error = %v, want CORS error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
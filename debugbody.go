@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// defaultDebugBodyMaxBytes 未配置 DebugBodyMaxBytes 时每个请求体/响应体最多记录的字节数
+const defaultDebugBodyMaxBytes = 4096
+
+// defaultRedactHeaders 调试日志中总是隐藏的请求头和响应头，CfHeaderName 也会隐藏
+var defaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// debugBodyMaxBytes 返回调试日志中请求体/响应体的截断长度
+func (c Config) debugBodyMaxBytes() int {
+	if c.DebugBodyMaxBytes <= 0 {
+		return defaultDebugBodyMaxBytes
+	}
+	return c.DebugBodyMaxBytes
+}
+
+// redactHeaders 返回隐藏了敏感值的请求头副本，原请求头不变
+func (c Config) redactHeaders(h http.Header) http.Header {
+	names := append([]string{c.cfHeaderName()}, defaultRedactHeaders...)
+	for _, route := range c.Routes {
+		if route.CfHeaderName != "" {
+			names = append(names, route.CfHeaderName)
+		}
+	}
+	out := h.Clone()
+	for _, name := range append(names, c.DebugRedactHeaders...) {
+		if _, ok := out[http.CanonicalHeaderKey(name)]; ok {
+			out.Set(name, "[REDACTED]")
+		}
+	}
+	return out
+}
+
+// captureBody 读取时旁路复制前 limit 个字节，不改变实际传输的内容
+type captureBody struct {
+	io.ReadCloser
+	limit int
+
+	mu  sync.Mutex // 请求体由 Transport 的写协程读取，与记录日志的协程并发
+	buf bytes.Buffer
+	cut bool // 内容超过 limit 被截断
+
+	onClose func(*captureBody) // 响应体关闭时输出日志
+	once    sync.Once
+}
+
+func (cb *captureBody) Read(p []byte) (int, error) {
+	n, err := cb.ReadCloser.Read(p)
+	cb.mu.Lock()
+	if room := cb.limit - cb.buf.Len(); n > room {
+		if room > 0 {
+			cb.buf.Write(p[:room])
+		}
+		cb.cut = true
+	} else {
+		cb.buf.Write(p[:n])
+	}
+	cb.mu.Unlock()
+	return n, err
+}
+
+func (cb *captureBody) Close() error {
+	err := cb.ReadCloser.Close()
+	if cb.onClose != nil {
+		cb.once.Do(func() { cb.onClose(cb) })
+	}
+	return err
+}
+
+// String 返回已记录的内容，截断时加上标记
+func (cb *captureBody) String() string {
+	if cb == nil {
+		return ""
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.cut {
+		return cb.buf.String() + "...(truncated)"
+	}
+	return cb.buf.String()
+}
+
+// captureRequestBody 在 Director 中包装转发给上游的请求体，协议升级（如 WebSocket）请求不处理
+func captureRequestBody(req *http.Request, cfg Config) {
+	if req.Header.Get("Upgrade") != "" {
+		return
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = &captureBody{ReadCloser: req.Body, limit: cfg.debugBodyMaxBytes()}
+	}
+}
+
+// logBodies 在 ModifyResponse 中包装响应体，客户端读完（响应体关闭）后记录请求和响应的请求头与内容
+// 101 响应的响应体是 ReverseProxy 需要写入的升级连接，不包装，只记录请求头和响应头
+func logBodies(resp *http.Response, cfg Config) {
+	req := resp.Request
+	reqBody, _ := req.Body.(*captureBody)
+	reqHeader := cfg.redactHeaders(req.Header)
+	respHeader := cfg.redactHeaders(resp.Header)
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		log.Printf("Debug body %s %s request headers=%v response %d headers=%v (protocol upgrade, bodies not logged)",
+			req.Method, req.URL, reqHeader, resp.StatusCode, respHeader)
+		return
+	}
+	resp.Body = &captureBody{
+		ReadCloser: resp.Body,
+		limit:      cfg.debugBodyMaxBytes(),
+		onClose: func(respBody *captureBody) {
+			log.Printf("Debug body %s %s request headers=%v body=%q response %d headers=%v body=%q",
+				req.Method, req.URL, reqHeader, reqBody.String(), resp.StatusCode, respHeader, respBody.String())
+		},
+	}
+}
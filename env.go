@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// envPrefix 环境变量前缀，变量名为前缀加配置项名的大写形式，如 GOWEB_RPADDR、GOWEB_CFHEADER
+const envPrefix = "GOWEB_"
+
+// applyEnv 用环境变量覆盖配置项
+//
+// 配置优先级（高到低）：环境变量 > 配置文件 > 程序内默认值。
+// 配置文件不存在时完全由环境变量提供配置；文件中已有的字段也会被同名环境变量覆盖。
+//
+// 取值格式：字符串原样使用；Duration 使用 "30s" 这样的写法；
+// 字符串列表用逗号分隔（"a,b,c"）；其余类型（数字、布尔、map、结构体）按 JSON 解析。
+func applyEnv(c *Config) error {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		key := envPrefix + strings.ToUpper(name)
+		raw, ok := os.LookupEnv(key)
+		if !ok {
+			continue
+		}
+		if err := setFromEnv(v.Field(i), raw); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// setFromEnv 将环境变量的字符串值写入配置字段
+func setFromEnv(field reflect.Value, raw string) error {
+	switch {
+	case field.Kind() == reflect.String:
+		field.SetString(raw)
+		return nil
+	case field.Type() == reflect.TypeOf(Duration(0)):
+		// 与配置文件一致，按 JSON 字符串解析
+		b, _ := json.Marshal(raw)
+		return json.Unmarshal(b, field.Addr().Interface())
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		var list []string
+		for _, s := range strings.Split(raw, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+		field.Set(reflect.ValueOf(list).Convert(field.Type()))
+		return nil
+	default:
+		return json.Unmarshal([]byte(raw), field.Addr().Interface())
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrorResponse 替换错误响应内容的模板，用于统一各服务的错误格式
+type ErrorResponse struct {
+	Body   string `json:"Body"`   // 返回的 JSON 内容，或 JSON 文件路径
+	Status int    `json:"Status"` // 覆盖返回的状态码，0 表示保持原状态码
+}
+
+// resolveErrorResponses 检查 ErrorResponses 的键（"404"、"502" 这样的状态码或 "4xx"、"5xx" 类别）并加载内容
+func resolveErrorResponses(templates map[string]ErrorResponse) (map[string]ErrorResponse, error) {
+	if len(templates) == 0 {
+		return nil, nil
+	}
+	out := make(map[string]ErrorResponse, len(templates))
+	for key, tmpl := range templates {
+		key = strings.ToLower(key)
+		if key != "4xx" && key != "5xx" {
+			if code, err := strconv.Atoi(key); err != nil || code < 400 || code > 599 {
+				return nil, fmt.Errorf("ErrorResponses key %q must be a 4xx/5xx status code or \"4xx\"/\"5xx\"", key)
+			}
+		}
+		if tmpl.Status != 0 && (tmpl.Status < 100 || tmpl.Status > 599) {
+			return nil, fmt.Errorf("ErrorResponses[%s].Status %d is not a valid HTTP status code", key, tmpl.Status)
+		}
+		field := fmt.Sprintf("ErrorResponses[%s].Body", key)
+		if tmpl.Body == "" {
+			return nil, fmt.Errorf("%s is required", field)
+		}
+		body, err := loadJSONBody(field, tmpl.Body, "")
+		if err != nil {
+			return nil, err
+		}
+		tmpl.Body = body
+		out[key] = tmpl
+	}
+	return out, nil
+}
+
+// errorResponse 返回状态码对应的模板，精确的状态码优先于类别
+func (c Config) errorResponse(status int) (ErrorResponse, bool) {
+	if tmpl, ok := c.errorResponses[strconv.Itoa(status)]; ok {
+		return tmpl, true
+	}
+	tmpl, ok := c.errorResponses[fmt.Sprintf("%dxx", status/100)]
+	return tmpl, ok
+}
+
+// replaceErrorResponse 在 ModifyResponse 中用模板替换上游的错误响应，未配置 Status 时保留上游的状态码
+func replaceErrorResponse(resp *http.Response, tmpl ErrorResponse) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+
+	body := withRequestID(tmpl.Body, resp.Request.Header.Get(requestIDHeader))
+	resp.Body = io.NopCloser(strings.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Type", "application/json")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Transfer-Encoding")
+	resp.Header.Del("ETag")
+	if tmpl.Status != 0 {
+		resp.StatusCode = tmpl.Status
+		resp.Status = fmt.Sprintf("%d %s", tmpl.Status, http.StatusText(tmpl.Status))
+	}
+}
+
+// writeProxyError 在 ErrorHandler 中返回代理自身产生的错误，配置了对应模板时使用模板的内容和状态码
+func writeProxyError(w http.ResponseWriter, r *http.Request, cfg Config, status int, body string) {
+	if tmpl, ok := cfg.errorResponse(status); ok {
+		body = tmpl.Body
+		if tmpl.Status != 0 {
+			status = tmpl.Status
+		}
+	}
+	writeJSON(w, status, withRequestID(body, r.Header.Get(requestIDHeader)))
+}
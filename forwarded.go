@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// isTrustedProxy 判断直接连接的对端地址是否属于 TrustedProxies
+func (c Config) isTrustedProxy(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && containsIP(c.trustedNets, ip)
+}
+
+// clientIP 返回用于日志、访问控制和限流的客户端地址
+// 配置了 ClientIPHeader 且对端属于 TrustedProxies 时使用该请求头（如 CF-Connecting-IP）中的 IP，此时没有端口；
+// 请求头缺失或内容不是合法 IP 时使用 forwardedClientIP 的结果。
+// 不信任对端时不读取任何转发头，避免客户端伪造地址绕过限流和访问控制
+func (c Config) clientIP(r *http.Request) (ip, port string) {
+	peer, port, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer, port = r.RemoteAddr, ""
+	}
+	if !c.isTrustedProxy(r.RemoteAddr) {
+		return peer, port
+	}
+	if c.ClientIPHeader != "" {
+		if v := strings.TrimSpace(r.Header.Get(c.ClientIPHeader)); net.ParseIP(v) != nil {
+			return v, ""
+		}
+	}
+	if ip := c.forwardedClientIP(r.Header.Get("X-Forwarded-For")); ip != "" {
+		return ip, ""
+	}
+	return peer, port
+}
+
+// forwardedClientIP 从右向左遍历 X-Forwarded-For，跳过属于 TrustedProxies 的地址，
+// 返回第一个不可信的地址；最左侧的条目可由客户端任意填写，不能直接采用。
+// 全部条目都可信时返回最左侧的地址，没有合法地址时返回空字符串
+func (c Config) forwardedClientIP(xff string) string {
+	var leftmost string
+	parts := strings.Split(xff, ",")
+	for i := len(parts) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(parts[i]))
+		if ip == nil {
+			// 无法解析的条目之前的内容都不可靠
+			break
+		}
+		if !containsIP(c.trustedNets, ip) {
+			return ip.String()
+		}
+		leftmost = ip.String()
+	}
+	return leftmost
+}
+
+// setForwardedHeaders 设置转发到上游的 X-Forwarded-* 和 X-Real-IP 请求头
+//
+// 只有对端属于 TrustedProxies 时才保留客户端带来的 X-Forwarded-For，否则丢弃以防伪造；
+// ReverseProxy 随后会把对端 IP 追加到 X-Forwarded-For 末尾。
+// X-Real-IP 与日志、访问控制和限流使用同一个地址（clientIP，包括 ClientIPHeader）。
+// X-Forwarded-Host 记录客户端请求的原始 Host，不受 PreserveHost 影响（在改写 Host 之前设置）。
+func setForwardedHeaders(req *http.Request, cfg Config) {
+	clientIP, _ := cfg.clientIP(req)
+	if !cfg.isTrustedProxy(req.RemoteAddr) {
+		req.Header.Del("X-Forwarded-For")
+	}
+
+	req.Header.Set("X-Real-IP", clientIP)
+	req.Header.Set("X-Forwarded-Host", req.Host)
+	if req.TLS != nil {
+		req.Header.Set("X-Forwarded-Proto", "https")
+	} else {
+		req.Header.Set("X-Forwarded-Proto", "http")
+	}
+}
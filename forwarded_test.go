@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSetForwardedHeadersRealIP(t *testing.T) {
+	tests := []struct {
+		name     string
+		remote   string
+		xff      string
+		cfIP     string
+		wantReal string
+		wantXFF  string
+	}{
+		{"client ip header from trusted proxy", "10.0.0.5:443", "198.51.100.9", "203.0.113.7", "203.0.113.7", "198.51.100.9"},
+		{"rightmost untrusted forwarded address", "10.0.0.5:443", "1.2.3.4, 203.0.113.7, 10.0.0.9", "", "203.0.113.7", "1.2.3.4, 203.0.113.7, 10.0.0.9"},
+		{"untrusted peer ignores headers", "203.0.113.50:5000", "1.2.3.4", "1.2.3.4", "203.0.113.50", ""},
+	}
+	cfg := Config{TrustedProxies: []string{"10.0.0.0/8"}, ClientIPHeader: "CF-Connecting-IP"}
+	if err := cfg.resolve(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if tt.cfIP != "" {
+				req.Header.Set("CF-Connecting-IP", tt.cfIP)
+			}
+			// 日志、访问控制和限流使用的地址
+			logged, _ := cfg.clientIP(req)
+
+			setForwardedHeaders(req, cfg)
+			if got := req.Header.Get("X-Real-IP"); got != tt.wantReal || got != logged {
+				t.Errorf("X-Real-IP = %q, clientIP = %q, want both %q", got, logged, tt.wantReal)
+			}
+			if got := req.Header.Get("X-Forwarded-For"); got != tt.wantXFF {
+				t.Errorf("X-Forwarded-For = %q, want %q", got, tt.wantXFF)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"log"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// geoFilter 按客户端 IP 所在国家做访问控制，BlockedCountries 优先于 AllowedCountries
+type geoFilter struct {
+	db    *maxminddb.Reader // 未配置 GeoDBPath 时为 nil，不做限制
+	allow map[string]bool
+	block map[string]bool
+}
+
+// activeGeo 当前生效的国家访问控制，配置重载时整体替换；数据库只在启动时打开（GeoDBPath 不支持重载）
+var activeGeo atomic.Pointer[geoFilter]
+
+// openGeoDB 打开 MaxMind mmdb 格式的数据库（如 GeoLite2-Country.mmdb），path 为空时返回 nil
+func openGeoDB(path string) (*maxminddb.Reader, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return maxminddb.Open(path)
+}
+
+// newGeoFilter 使用已打开的数据库和国家代码列表创建访问控制，国家代码不区分大小写
+func newGeoFilter(db *maxminddb.Reader, allowed, blocked []string) *geoFilter {
+	return &geoFilter{db: db, allow: countrySet(allowed), block: countrySet(blocked)}
+}
+
+// countrySet 将 ISO 3166-1 国家代码列表转为集合
+func countrySet(codes []string) map[string]bool {
+	set := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		set[strings.ToUpper(strings.TrimSpace(code))] = true
+	}
+	return set
+}
+
+// country 查询 IP 所在国家的 ISO 代码，数据库中没有记录（如内网地址）时返回空字符串
+func (g *geoFilter) country(ip net.IP) (string, error) {
+	var record struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+	}
+	if err := g.db.Lookup(ip, &record); err != nil {
+		return "", err
+	}
+	return record.Country.ISOCode, nil
+}
+
+// permits 判断客户端 IP 所在国家是否允许访问
+// 查询失败时记录警告并放行，避免数据库问题导致整个服务不可用；查不到国家的地址按 allowsCountry 处理
+func (g *geoFilter) permits(ip string) bool {
+	if g == nil || g.db == nil || len(g.allow) == 0 && len(g.block) == 0 {
+		return true
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return true
+	}
+	code, err := g.country(parsed)
+	if err != nil {
+		log.Printf("Warning: GeoIP lookup failed for %s, allowing request: %v", ip, err)
+		return true
+	}
+	return g.allowsCountry(code)
+}
+
+// allowsCountry 按国家代码判断是否允许访问；配置了 AllowedCountries 时没有国家记录（code 为空）的地址拒绝，
+// 白名单不能因为数据库缺少记录而失效，只配置了 BlockedCountries 时放行
+func (g *geoFilter) allowsCountry(code string) bool {
+	if g.block[code] {
+		return false
+	}
+	return len(g.allow) == 0 || g.allow[code]
+}
+
+// database 返回已打开的数据库，供重载时沿用
+func (g *geoFilter) database() *maxminddb.Reader {
+	if g == nil {
+		return nil
+	}
+	return g.db
+}
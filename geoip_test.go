@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestGeoFilterAllowsCountry(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		blocked []string
+		code    string
+		want    bool
+	}{
+		{"allowlisted", []string{"cn", "US"}, nil, "CN", true},
+		{"not allowlisted", []string{"CN"}, nil, "DE", false},
+		{"no record with allowlist", []string{"CN"}, nil, "", false},
+		{"no record with blocklist only", nil, []string{"RU"}, "", true},
+		{"blocked", nil, []string{"RU"}, "RU", false},
+		{"blocked wins over allowed", []string{"RU"}, []string{"RU"}, "RU", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newGeoFilter(nil, tt.allowed, tt.blocked)
+			if got := g.allowsCountry(tt.code); got != tt.want {
+				t.Errorf("allowsCountry(%q) = %v, want %v", tt.code, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// stickyHash 按请求头（未配置或缺失时按客户端 IP）在一致性哈希环上选择目标
+const stickyHash = "consistent-hash"
+
+// ringReplicas 每个目标在哈希环上的虚拟节点数（乘以权重），越多分布越均匀
+const ringReplicas = 160
+
+// ringPoint 哈希环上的一个虚拟节点
+type ringPoint struct {
+	hash uint32
+	be   *backend
+}
+
+// hashRing 一致性哈希环：增删目标时只有落在该目标区间的 key 会改变去向
+type hashRing []ringPoint
+
+// newHashRing 按目标地址生成虚拟节点，同一组目标无论顺序如何得到相同的环
+func newHashRing(backends []*backend) hashRing {
+	var ring hashRing
+	for _, be := range backends {
+		addr := be.target.String()
+		for i := 0; i < ringReplicas*be.weight; i++ {
+			ring = append(ring, ringPoint{hash: mixHash(hashString(addr + "#" + strconv.Itoa(i))), be: be})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	return ring
+}
+
+// mixHash 打散 FNV 哈希的低位，相近的字符串（如 "a#1"、"a#2"）也能均匀分布在环上
+func mixHash(h uint32) uint32 {
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
+
+// lookup 从 key 的哈希位置顺时针找到第一个可用目标，选中的目标不可用时依次落到环上的下一个目标
+// 全部不可用时返回 nil
+func (ring hashRing) lookup(key string) *backend {
+	if len(ring) == 0 {
+		return nil
+	}
+	h := mixHash(hashString(key))
+	start := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= h })
+	for i := 0; i < len(ring); i++ {
+		if be := ring[(start+i)%len(ring)].be; !be.down.Load() {
+			return be
+		}
+	}
+	return nil
+}
+
+// hashKey 返回一致性哈希使用的 key：HashKeyHeader 请求头的值，未配置或请求头为空时使用客户端 IP
+func (c Config) hashKey(r *http.Request, ip string) string {
+	if c.HashKeyHeader != "" {
+		if v := r.Header.Get(c.HashKeyHeader); v != "" {
+			return v
+		}
+	}
+	return ip
+}
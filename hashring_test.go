@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+// ringTargets 生成 n 个等权重目标 http://b0 ... http://b{n-1}
+func ringTargets(n int) []WeightedTarget {
+	targets := make([]WeightedTarget, n)
+	for i := range targets {
+		targets[i] = WeightedTarget{Addr: fmt.Sprintf("http://b%d", i), Weight: 1}
+	}
+	return targets
+}
+
+// ringAssignments 返回每个 key 在环上选中的目标主机名
+func ringAssignments(t *testing.T, targets []WeightedTarget, keys int) []string {
+	t.Helper()
+	b, err := newBalancer(targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := make([]string, keys)
+	for i := range hosts {
+		hosts[i] = b.ring.lookup(fmt.Sprintf("user-%d", i)).target.Host
+	}
+	return hosts
+}
+
+func TestHashRingStability(t *testing.T) {
+	const n, keys = 5, 10000
+	base := ringAssignments(t, ringTargets(n), keys)
+
+	tests := []struct {
+		name    string
+		targets []WeightedTarget
+		want    float64 // 理论上改变去向的 key 比例
+	}{
+		{"add one backend", ringTargets(n + 1), 1.0 / (n + 1)},
+		{"remove one backend", ringTargets(n)[:n-1], 1.0 / n},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ringAssignments(t, tt.targets, keys)
+			moved := 0
+			for i := range got {
+				if got[i] == base[i] {
+					continue
+				}
+				moved++
+				// 只有新增目标接走 key，或被删除目标上的 key 重新分配
+				if got[i] != fmt.Sprintf("b%d", n) && base[i] != fmt.Sprintf("b%d", n-1) {
+					t.Fatalf("key %d moved from %s to %s", i, base[i], got[i])
+				}
+			}
+			ratio := float64(moved) / keys
+			if ratio < tt.want/2 || ratio > tt.want*1.5 {
+				t.Errorf("moved %.1f%% of keys, want about %.1f%%", ratio*100, tt.want*100)
+			}
+		})
+	}
+}
+
+func TestHashKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string // HashKeyHeader 配置
+		value  string // 请求中该请求头的值
+		want   string
+	}{
+		{"header present", "X-User-ID", "alice", "alice"},
+		{"header missing", "X-User-ID", "", "203.0.113.7"},
+		{"header not configured", "", "alice", "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.value != "" {
+				r.Header.Set("X-User-ID", tt.value)
+			}
+			cfg := Config{HashKeyHeader: tt.header}
+			if got := cfg.hashKey(r, "203.0.113.7"); got != tt.want {
+				t.Errorf("hashKey = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConsistentHashPrefersHeader(t *testing.T) {
+	b, err := newBalancer(ringTargets(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{Stickiness: stickyHash, HashKeyHeader: "X-User-ID"}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-User-ID", "alice")
+	want := b.ring.lookup("alice")
+
+	// 同一个用户从不同 IP 访问仍落到同一个目标
+	for i := 0; i < 20; i++ {
+		be, pinned := b.sticky(cfg, r, fmt.Sprintf("198.51.100.%d", i))
+		if !pinned || be != want {
+			t.Fatalf("request from ip %d routed to %s, want %s", i, be.target.Host, want.target.Host)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 主动健康检查默认参数
+const (
+	defaultHealthCheckInterval  = 10 * time.Second
+	defaultHealthCheckTimeout   = 5 * time.Second
+	defaultHealthCheckThreshold = 3
+)
+
+// runHealthChecks 定期探测当前承载流量的每个目标的 HealthCheckPath，连续失败达到阈值后移出轮询，探测成功一次即恢复
+// Routes/Hosts 的目标每个只对应一组请求，无法切换，探测结果只用于日志和 ReadinessPath
+func runHealthChecks() {
+	// 与代理使用相同的上游 TLS 设置，私有 CA 签发的上游才能通过探测；配置已校验过，这里不会失败
+	transport, err := newTransport(loadConfig())
+	if err != nil {
+		log.Println("Health checks disabled:", err)
+		return
+	}
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   defaultHealthCheckTimeout,
+		// 3xx 也视为存活，不跟随跳转
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	for {
+		cfg := loadConfig()
+		if cfg.HealthCheckPath != "" {
+			threshold := cfg.HealthCheckUnhealthyThreshold
+			if threshold <= 0 {
+				threshold = defaultHealthCheckThreshold
+			}
+			var wg sync.WaitGroup
+			for _, be := range probedBackends(cfg) {
+				wg.Add(1)
+				go func(be *backend) {
+					defer wg.Done()
+					be.markHealth(probeBackend(client, be, cfg.HealthCheckPath), threshold)
+				}(be)
+			}
+			wg.Wait()
+		}
+		time.Sleep(cfg.HealthCheckInterval.or(defaultHealthCheckInterval))
+	}
+}
+
+// probeBackend 请求目标的健康检查路径，2xx 和 3xx 视为健康
+func probeBackend(client *http.Client, be *backend, path string) bool {
+	u := *be.target
+	u.Path = path
+	u.RawPath = ""
+	u.RawQuery = ""
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 400
+}
+
+// markHealth 记录一次探测结果，并在健康状态变化时记录日志
+func (be *backend) markHealth(ok bool, threshold int) {
+	if ok {
+		be.passed.Store(true)
+		be.fails.Store(0)
+		if be.down.Swap(false) {
+			log.Printf("Upstream %s is healthy again", be.target)
+		}
+		return
+	}
+	if int(be.fails.Add(1)) >= threshold && !be.down.Swap(true) {
+		log.Printf("Upstream %s is unhealthy, removed from rotation", be.target)
+	}
+}
+
+// servingBackends 返回当前承载流量的主目标：配置了 Routes 时为各路由目标，配置了 Hosts 时为各主机目标，否则为负载均衡器的目标
+// Routes/Hosts 模式下负载均衡器只有一个由空 RpAddr 生成的占位目标，不能拿来探测
+func servingBackends(cfg Config) []*backend {
+	switch {
+	case len(cfg.Routes) > 0:
+		return activeRouter.Load().backends
+	case len(cfg.Hosts) > 0:
+		return activeHosts.Load().list()
+	default:
+		return activeBalancer.Load().backends
+	}
+}
+
+// probedBackends 返回需要健康检查的目标：主目标加上金丝雀目标
+func probedBackends(cfg Config) []*backend {
+	backends := servingBackends(cfg)
+	if cb := activeCanary.Load(); cb != nil {
+		backends = append(backends[:len(backends):len(backends)], cb)
+	}
+	return backends
+}
+
+// upstreamReady 判断是否至少有一个主目标通过了健康检查且当前可用，用于 ReadinessPath
+// 金丝雀目标只分担部分流量，不参与判断
+func upstreamReady(cfg Config) bool {
+	for _, be := range servingBackends(cfg) {
+		if be.passed.Load() && !be.down.Load() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// hijackedConns 记录 WebSocket 握手后被接管的客户端连接，http.Server.Shutdown 不会等待或关闭这些连接
+var hijackedConns = &connSet{conns: make(map[*trackedConn]struct{})}
+
+// connSet 当前仍打开的被接管连接
+type connSet struct {
+	mu    sync.Mutex
+	conns map[*trackedConn]struct{}
+}
+
+// trackedConn 关闭时从 connSet 中移除的连接
+type trackedConn struct {
+	net.Conn
+	set  *connSet
+	once sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() {
+		c.set.mu.Lock()
+		delete(c.set.conns, c)
+		c.set.mu.Unlock()
+	})
+	return c.Conn.Close()
+}
+
+// track 开始记录连接，返回的连接关闭时自动移除
+func (s *connSet) track(conn net.Conn) net.Conn {
+	c := &trackedConn{Conn: conn, set: s}
+	s.mu.Lock()
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+	return c
+}
+
+// len 返回仍打开的连接数
+func (s *connSet) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// closeAll 强制关闭所有连接，返回关闭的数量；客户端连接关闭后 ReverseProxy 会随之关闭上游连接
+func (s *connSet) closeAll() int {
+	s.mu.Lock()
+	conns := make([]*trackedConn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+	for _, c := range conns {
+		c.Close()
+	}
+	return len(conns)
+}
+
+// drainWebSockets 在优雅关闭时等待 WebSocket 连接在 timeout 内自行关闭，超时后强制关闭剩余的连接
+func drainWebSockets(timeout time.Duration) {
+	n := hijackedConns.len()
+	if n == 0 {
+		return
+	}
+	log.Printf("Waiting up to %v for %d WebSocket connections to close", timeout, n)
+	deadline := time.Now().Add(timeout)
+	for hijackedConns.len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if closed := hijackedConns.closeAll(); closed > 0 {
+		log.Printf("Force-closed %d WebSocket connections after %v", closed, timeout)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"sync/atomic"
+)
+
+// hostBackends 虚拟主机表：按请求的主机名选择代理目标
+type hostBackends map[string]*backend
+
+// activeHosts 当前生效的虚拟主机表，配置重载时整体替换
+var activeHosts atomic.Pointer[hostBackends]
+
+// newHostBackends 解析每个主机名的转发目标，主机名不区分大小写
+func newHostBackends(hosts map[string]string) (*hostBackends, error) {
+	hb := make(hostBackends, len(hosts))
+	for host, target := range hosts {
+		b, err := newBackend(target)
+		if err != nil {
+			return nil, err
+		}
+		hb[normalizeHost(host)] = b
+	}
+	return &hb, nil
+}
+
+// normalizeHost 去掉端口和末尾的点并转为小写，"Example.com.:443" 与 "example.com" 视为同一主机
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// list 返回所有主机的代理目标，用于健康检查
+func (hb *hostBackends) list() []*backend {
+	backends := make([]*backend, 0, len(*hb))
+	for _, b := range *hb {
+		backends = append(backends, b)
+	}
+	return backends
+}
+
+// match 返回 Host 对应的代理目标，未配置的主机返回 nil
+func (hb *hostBackends) match(host string) *backend {
+	return (*hb)[normalizeHost(host)]
+}
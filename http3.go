@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// setupHTTP3Server 创建与 TLS 服务器共用处理器和证书的 HTTP/3 服务器，监听同一端口的 UDP
+func setupHTTP3Server(server *http.Server) *http3.Server {
+	return &http3.Server{
+		Addr:      server.Addr,
+		Handler:   server.Handler,
+		TLSConfig: http3.ConfigureTLSConfig(server.TLSConfig.Clone()),
+	}
+}
+
+// altSvcHandler 在 HTTP/1.1 和 HTTP/2 响应中添加 Alt-Svc 头，让浏览器升级到 HTTP/3
+func altSvcHandler(h3 *http3.Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor < 3 {
+			h3.SetQUICHeaders(w.Header())
+		}
+		next.ServeHTTP(w, r)
+	})
+}
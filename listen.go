@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// defaultListenAddr 未配置 ListenAddr 时的 HTTPS 监听地址
+const defaultListenAddr = ":443"
+
+// unixAddrPrefix ListenAddr 以此开头时监听 Unix 套接字，如 "unix:/run/goweb.sock"
+const unixAddrPrefix = "unix:"
+
+// listenAddr 返回主服务的监听地址
+func (c Config) listenAddr() string {
+	if c.ListenAddr == "" {
+		return defaultListenAddr
+	}
+	return c.ListenAddr
+}
+
+// unixSocketPath 返回 Unix 套接字路径，ListenAddr 不是 unix: 地址时返回 false
+func (c Config) unixSocketPath() (string, bool) {
+	return strings.CutPrefix(c.listenAddr(), unixAddrPrefix)
+}
+
+// listenUnix 监听 Unix 套接字，先删除上次异常退出遗留的套接字文件
+// net.UnixListener 关闭时会自动删除套接字文件，优雅关闭后不会残留
+func listenUnix(path string) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	return net.Listen("unix", path)
+}
+
+// 访问日志中记录的监听器名称
+const (
+	listenerHTTPS = "https"
+	listenerHTTP  = "http"
+	listenerUnix  = "unix"
+)
+
+// listenerKey 明文 HTTP 服务器在请求上下文中标记监听器名称
+type listenerKey struct{}
+
+// listenerName 返回接收请求的监听器：明文 HTTP 监听、TLS（含 HTTP/3）或 Unix 套接字
+func listenerName(r *http.Request) string {
+	if name, ok := r.Context().Value(listenerKey{}).(string); ok {
+		return name
+	}
+	if r.TLS == nil {
+		return listenerUnix
+	}
+	return listenerHTTPS
+}
+
+// setupPlainServer 创建在 HTTPListenAddr 上提供明文 HTTP 的服务器，处理器和超时设置与主服务相同
+// 使用 ACME 时同时应答 HTTP-01 验证
+func setupPlainServer(server *http.Server, addr string) *http.Server {
+	handler := server.Handler
+	if acmeManager != nil {
+		handler = acmeManager.HTTPHandler(handler)
+	}
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       server.ReadTimeout,
+		ReadHeaderTimeout: server.ReadHeaderTimeout,
+		WriteTimeout:      server.WriteTimeout,
+		IdleTimeout:       server.IdleTimeout,
+		MaxHeaderBytes:    server.MaxHeaderBytes,
+		BaseContext: func(net.Listener) context.Context {
+			return context.WithValue(context.Background(), listenerKey{}, listenerHTTP)
+		},
+	}
+}
+
+// plainServesPort80 判断明文 HTTP 是否监听 80 端口
+func plainServesPort80(addr string) bool {
+	_, port, err := net.SplitHostPort(addr)
+	return err == nil && port == "80"
+}
+
+// proxyHeaderTimeout 新连接发送 PROXY 协议头的最长等待时间
+const proxyHeaderTimeout = 10 * time.Second
+
+// serveTCP 在 srv.Addr 上监听 TCP 并提供服务，useTLS 时使用 TLSConfig 中的证书
+// proxyProtocol 为 true 时解析 PROXY 协议头，只用于前置负载均衡器转发到的主监听
+func serveTCP(srv *http.Server, useTLS, proxyProtocol bool) error {
+	ln, err := listenTCP(srv.Addr, proxyProtocol)
+	if err != nil {
+		return err
+	}
+	if useTLS {
+		return srv.ServeTLS(ln, "", "")
+	}
+	return srv.Serve(ln)
+}
+
+// listenTCP 监听 TCP 地址，proxyProtocol 时解析 PROXY 协议头，连接的 RemoteAddr 变为真实的客户端地址
+func listenTCP(addr string, proxyProtocol bool) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil || !proxyProtocol {
+		return ln, err
+	}
+	return &proxyproto.Listener{
+		Listener:          ln,
+		ConnPolicy:        proxyProtocolPolicy,
+		ReadHeaderTimeout: proxyHeaderTimeout,
+	}, nil
+}
+
+// proxyProtocolPolicy TrustedProxies 中的负载均衡器必须发送 PROXY 协议头；
+// 其他来源带协议头的连接直接拒绝，避免伪造客户端地址绕过访问控制和限流，不带协议头时按实际地址处理
+// （校验保证启用时 TrustedProxies 不为空）
+func proxyProtocolPolicy(opts proxyproto.ConnPolicyOptions) (proxyproto.Policy, error) {
+	if loadConfig().isTrustedProxy(opts.Upstream.String()) {
+		return proxyproto.REQUIRE, nil
+	}
+	return proxyproto.REJECT, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func TestProxyProtocolPolicy(t *testing.T) {
+	cfg := Config{EnableProxyProtocol: true, TrustedProxies: []string{"10.0.0.0/8"}}
+	if err := cfg.resolve(); err != nil {
+		t.Fatal(err)
+	}
+	setTestConfig(t, cfg)
+
+	tests := []struct {
+		peer string
+		want proxyproto.Policy
+	}{
+		{"10.1.2.3", proxyproto.REQUIRE},
+		{"203.0.113.7", proxyproto.REJECT},
+	}
+	for _, tt := range tests {
+		opts := proxyproto.ConnPolicyOptions{Upstream: &net.TCPAddr{IP: net.ParseIP(tt.peer), Port: 40000}}
+		if got, err := proxyProtocolPolicy(opts); err != nil || got != tt.want {
+			t.Errorf("policy for %s = %v (err %v), want %v", tt.peer, got, err, tt.want)
+		}
+	}
+}
+
+func TestProxyProtocolRequiresTrustedProxies(t *testing.T) {
+	err := validateConfig(Config{EnableProxyProtocol: true})
+	if err == nil || !strings.Contains(err.Error(), "EnableProxyProtocol requires TrustedProxies") {
+		t.Fatalf("validateConfig error = %v, want EnableProxyProtocol requires TrustedProxies", err)
+	}
+}
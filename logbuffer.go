@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// logFlushInterval 缓冲的访问日志定期刷出的间隔
+const logFlushInterval = time.Second
+
+// accessBuffer 配置了 LogBufferSize 时访问日志先写入的缓冲区，未配置时为 nil
+// 程序日志不经过缓冲，退出前的错误信息不会丢失；退出路径使用 fatal/fatalf 先写出缓冲的访问日志
+var accessBuffer *logBuffer
+
+// logBuffer 合并访问日志的小块写入，减少写文件的系统调用；多个请求 goroutine 并发写入，所有操作都在锁内进行
+//
+// bufio.Writer 出错后会一直返回第一次的错误，因此写出失败时丢弃缓冲的内容并重新指向同一个输出，
+// 一次短暂的写入失败不会导致之后的访问日志全部丢失
+type logBuffer struct {
+	mu  sync.Mutex
+	buf *bufio.Writer
+	out io.Writer // 当前输出，写出失败后重新指向它
+}
+
+// newLogBuffer 创建写入 out 的缓冲区
+func newLogBuffer(out io.Writer, size int) *logBuffer {
+	return &logBuffer{buf: bufio.NewWriterSize(out, size), out: out}
+}
+
+// Write 实现 io.Writer，缓冲区满时自动写出；写出失败时记录到程序日志
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	n, err := b.buf.Write(p)
+	if err != nil {
+		b.buf.Reset(b.out)
+	}
+	b.mu.Unlock()
+	// 程序日志不经过缓冲区，在锁外记录
+	if err != nil {
+		log.Println("Failed to write access log:", err)
+	}
+	return n, err
+}
+
+// Flush 将缓冲的内容写出，失败时由调用方记录错误
+func (b *logBuffer) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	err := b.buf.Flush()
+	if err != nil {
+		b.buf.Reset(b.out)
+	}
+	return err
+}
+
+// reset 将已缓冲的内容写入原输出后切换到 out，日志文件重新打开时调用
+func (b *logBuffer) reset(out io.Writer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Flush()
+	b.buf.Reset(out)
+	b.out = out
+}
+
+// flushAccessLog 将缓冲的访问日志写出，关闭服务和处理 panic 时调用；未启用缓冲时不做处理
+func flushAccessLog() {
+	if accessBuffer == nil {
+		return
+	}
+	if err := accessBuffer.Flush(); err != nil {
+		log.Println("Failed to flush access log:", err)
+	}
+}
+
+// fatal 写出缓冲的访问日志后调用 log.Fatal 退出，os.Exit 不会执行 defer，直接调用 log.Fatal 会丢失缓冲中的访问日志
+func fatal(v ...any) {
+	flushAccessLog()
+	log.Fatal(v...)
+}
+
+// fatalf 同 fatal，按格式输出错误信息
+func fatalf(format string, v ...any) {
+	flushAccessLog()
+	log.Fatalf(format, v...)
+}
+
+// runLogFlusher 定期写出缓冲的访问日志，保证低流量时日志也能及时落盘
+func runLogFlusher() {
+	if accessBuffer == nil {
+		return
+	}
+	for range time.Tick(logFlushInterval) {
+		flushAccessLog()
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// accessLogLine 一条典型的访问日志，长度与实际输出相近
+const accessLogLine = "2026/10/15 08:05:54 |2026-10-15T08:05:54Z|/api/users||secret|203.0.113.7:51234|203.0.113.7:51234|Mozilla/5.0|582d78e6-6147-441d-8fdb-c89315765583|200|1532||||0.823\n"
+
+func TestLogBufferFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	b := newLogBuffer(f, 64<<10)
+	io.WriteString(b, accessLogLine)
+	if data, _ := os.ReadFile(path); len(data) != 0 {
+		t.Fatalf("buffered line written before flush: %q", data)
+	}
+	if err := b.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != accessLogLine {
+		t.Fatalf("file = %q after flush, want %q", data, accessLogLine)
+	}
+}
+
+// flakyWriter 前 failures 次写入返回错误，之后正常写入
+type flakyWriter struct {
+	failures int
+	buf      bytes.Buffer
+}
+
+func (w *flakyWriter) Write(p []byte) (int, error) {
+	if w.failures > 0 {
+		w.failures--
+		return 0, errors.New("disk full")
+	}
+	return w.buf.Write(p)
+}
+
+func TestLogBufferRecoversAfterWriteError(t *testing.T) {
+	captureLog(t)
+	out := &flakyWriter{failures: 1}
+	b := newLogBuffer(out, 64)
+
+	io.WriteString(b, accessLogLine) // 超过缓冲区大小，直接写出并失败
+	if err := b.Flush(); err != nil {
+		t.Fatalf("flush after failed write: %v", err)
+	}
+	// 之后的日志不会因为第一次的错误全部丢失
+	if _, err := io.WriteString(b, "next line\n"); err != nil {
+		t.Fatalf("write after failure: %v", err)
+	}
+	if err := b.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if got := out.buf.String(); got != "next line\n" {
+		t.Errorf("output = %q, want the line written after the failure", got)
+	}
+}
+
+// BenchmarkAccessLogWrite 对比访问日志直接写文件和经过 LogBufferSize 缓冲写文件的开销
+func BenchmarkAccessLogWrite(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		size int // 缓冲区大小，0 表示不缓冲
+	}{
+		{"unbuffered", 0},
+		{"buffered-64KB", 64 << 10},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			f, err := os.Create(filepath.Join(b.TempDir(), "access.log"))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer f.Close()
+
+			var w io.Writer = f
+			if bc.size > 0 {
+				buf := newLogBuffer(f, bc.size)
+				defer buf.Flush()
+				w = buf
+			}
+			line := []byte(accessLogLine)
+			b.SetBytes(int64(len(line)))
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					w.Write(line)
+				}
+			})
+		})
+	}
+}
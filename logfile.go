@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"log/syslog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// 日志输出位置
+const (
+	logTargetFile   = "file"
+	logTargetStdout = "stdout"
+	logTargetSyslog = "syslog"
+)
+
+// syslogPriority 写入 syslog 时使用的设施和级别，程序日志与访问日志相同
+const syslogPriority = syslog.LOG_DAEMON | syslog.LOG_INFO
+
+// logTarget 返回日志输出位置，默认写入文件
+func (c Config) logTarget() string {
+	if c.LogTarget == "" {
+		return logTargetFile
+	}
+	return c.LogTarget
+}
+
+// parseSyslogAddr 将 "udp://host:514" 拆分为网络类型和地址，为空表示本机 syslog
+func parseSyslogAddr(addr string) (network, raddr string, err error) {
+	if addr == "" {
+		return "", "", nil
+	}
+	network, raddr, ok := strings.Cut(addr, "://")
+	if !ok || raddr == "" || (network != "udp" && network != "tcp") {
+		return "", "", fmt.Errorf("SyslogAddr %q must look like udp://host:port or tcp://host:port", addr)
+	}
+	return network, raddr, nil
+}
+
+// newLogOutput 按 LogTarget 创建程序日志的写入器：文件（支持轮转）、stdout 或 syslog
+func newLogOutput(cfg Config) (*logWriter, error) {
+	switch cfg.logTarget() {
+	case logTargetStdout:
+		return &logWriter{file: os.Stdout}, nil
+	case logTargetSyslog:
+		network, raddr, err := parseSyslogAddr(cfg.SyslogAddr)
+		if err != nil {
+			return nil, err
+		}
+		sw, err := syslog.Dial(network, raddr, syslogPriority, "goweb")
+		if err != nil {
+			return nil, err
+		}
+		return &logWriter{sink: sw}, nil
+	}
+	return newLogWriter(cfg.LogFile, cfg.LogMaxSizeMB, cfg.LogMaxBackups)
+}
+
+// setLogOutputs 将程序日志指向 logFile，访问日志指向 accessLogFile（未配置时同样指向 logFile），配置了 LogBufferSize 时经过缓冲
+// 启动和重载时调用，调用方需持有 configMu
+func setLogOutputs() {
+	log.SetOutput(logFile)
+	var out io.Writer = logFile
+	if accessLogFile != nil {
+		out = accessLogFile
+	}
+	// 启用缓冲时先把旧输出的缓冲内容写出再切换，访问日志仍写入缓冲区
+	if accessBuffer != nil {
+		accessBuffer.reset(out)
+		out = accessBuffer
+	}
+	accessLog.SetOutput(out)
+}
+
+// logWriter 日志文件写入器，文件超过大小上限时轮转为 <file>.1、<file>.2 ...
+// log 包会在多个请求 goroutine 中并发写入，所有操作都在锁内进行
+type logWriter struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64 // 单个文件的最大字节数，0 表示不轮转
+	maxBackups int   // 保留的历史文件个数
+	file       *os.File
+	size       int64          // 当前文件已写入的字节数
+	sink       io.WriteCloser // 非文件输出（syslog），设置时代替 file
+}
+
+// newLogWriter 打开日志文件并创建写入器
+func newLogWriter(path string, maxSizeMB, maxBackups int) (*logWriter, error) {
+	w := &logWriter{path: path}
+	w.setLimits(maxSizeMB, maxBackups)
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// newStderrWriter 创建输出到 stderr 的写入器，日志文件无法打开时使用，不做轮转
+func newStderrWriter() *logWriter {
+	return &logWriter{file: os.Stderr}
+}
+
+// setLimits 更新轮转参数，配置重载时调用
+func (w *logWriter) setLimits(maxSizeMB, maxBackups int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.maxSize = int64(maxSizeMB) * 1024 * 1024
+	w.maxBackups = maxBackups
+}
+
+// open 以追加模式打开日志文件并记录当前大小
+func (w *logWriter) open() error {
+	f, err := openLogFile(w.path)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = fi.Size()
+	return nil
+}
+
+// reopen 重新打开日志文件，供外部轮转（如 logrotate）后切换到新文件
+// 新文件打开失败时继续写入旧文件；stderr 写入器不做处理
+func (w *logWriter) reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.path == "" {
+		return nil
+	}
+	old := w.file
+	if err := w.open(); err != nil {
+		return err
+	}
+	return old.Close()
+}
+
+// Write 实现 io.Writer，写入前检查是否需要轮转
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.sink != nil {
+		return w.sink.Write(p)
+	}
+	if w.path != "" && w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			// 轮转失败时继续写入当前文件，不能让日志本身中断请求处理
+			fmt.Fprintln(os.Stderr, "log rotation failed:", err)
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// rotate 依次后移历史文件，将当前文件重命名为 <file>.1 后重新打开
+func (w *logWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	os.Remove(fmt.Sprintf("%s.%d", w.path, w.maxBackups))
+	for i := w.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", w.path, i), fmt.Sprintf("%s.%d", w.path, i+1))
+	}
+	if w.maxBackups > 0 {
+		if err := os.Rename(w.path, w.path+".1"); err != nil {
+			w.open()
+			return err
+		}
+	} else {
+		os.Remove(w.path)
+	}
+	return w.open()
+}
+
+// Close 将缓冲内容刷到磁盘并关闭文件，stderr 和 stdout 不会被关闭
+func (w *logWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.sink != nil {
+		return w.sink.Close()
+	}
+	if w.path == "" {
+		return nil
+	}
+	w.file.Sync()
+	return w.file.Close()
+}
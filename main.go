@@ -1,142 +1,1543 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"math/rand"
+	"net"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
 	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
-	"github.com/netinternet/remoteaddr"
+	"github.com/quic-go/quic-go/http3"
 )
 
-var logFile *os.File
+var logFile *logWriter
+var accessLogFile *logWriter                          // AccessLogFile 的写入器，未配置时为 nil，访问日志写入 logFile
+var accessLog = log.New(os.Stderr, "", log.LstdFlags) // 访问日志输出，由 setLogOutputs 设置
 var config Config
+var configMu sync.RWMutex        // 保护 config、logFile 与 accessLogFile，请求读取与重载写入可能并发
+var configPath string            // 配置文件路径，重载时重新读取
+var logMode string               // 访问日志格式，启动时从 LogFormat 读取一次
+var logTimeLayout = time.RFC3339 // 访问日志的时间格式，启动时由 LogTimeFormat 解析一次
 
-// init 函数在程序启动时初始化配置和日志文件
-func init() {
+// setup 在 main 开始时解析命令行、加载配置并打开日志文件
+// 不放在 init 中，测试和 NewHandler 不依赖命令行参数和配置文件
+func setup() {
 	// 从命令行读取配置文件路径
-	configPath := flag.String("config", "", "Path to config file")
+	flag.StringVar(&configPath, "config", "", "Path to config file, \"-\" for stdin, or an http(s):// URL; separate several with commas to merge them in order")
+	check := flag.Bool("check", false, "Validate the config file and exit without starting the server")
 	flag.Parse()
-	if *configPath == "" {
-		*configPath = "/root/mywebproject/config.json" // 默认配置文件路径
+	if configPath == "" {
+		configPath = "/root/mywebproject/config.json" // 默认配置文件路径
 	}
 
 	// 加载配置文件
-	loadFile(*configPath)
-
 	var err error
-	logFile, err = os.OpenFile(loadConfig().LogFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	config, err = loadFile(configPath)
+	if err != nil {
+		fatal(err)
+	}
+	if err := validateConfig(config); err != nil {
+		fatal(err)
+	}
+	// -check 只校验配置，不打开日志文件和监听端口
+	if *check {
+		fmt.Printf("Config %s is valid\n", configPath)
+		os.Exit(0)
+	}
+
+	cfg := loadConfig()
+	logFile, err = newLogOutput(cfg)
 	if err != nil {
-		log.Fatalf("error opening file: %v", err)
+		if !cfg.logFallbackStderr() {
+			fatalf("error opening file: %v", err)
+		}
+		log.Printf("Warning: error opening log %s, logging to stderr: %v", cfg.logTarget(), err)
+		logFile = newStderrWriter()
 	}
-	log.SetOutput(logFile) // 设置日志输出到文件
+	// 配置了 AccessLogFile 时访问日志单独写入，否则与程序日志共用 LogFile
+	if cfg.AccessLogFile != "" {
+		accessLogFile, err = newLogWriter(cfg.AccessLogFile, cfg.LogMaxSizeMB, cfg.LogMaxBackups)
+		if err != nil {
+			if !cfg.logFallbackStderr() {
+				fatalf("error opening access log file: %v", err)
+			}
+			log.Printf("Warning: error opening access log file, writing access logs to the main log: %v", err)
+			accessLogFile = nil
+		}
+	}
+	if cfg.LogBufferSize > 0 {
+		accessBuffer = newLogBuffer(logFile, cfg.LogBufferSize)
+	}
+	setLogOutputs() // 设置日志输出到文件
+	logMode = cfg.LogFormat
+	logTimeLayout = cfg.logTimeLayout()
 }
 
 // Config 结构体用于存储配置文件中的配置项
 type Config struct {
-	CertFile string `json:"CertFile"` // TLS 证书文件路径
-	KeyFile  string `json:"KeyFile"`  // TLS 私钥文件路径
-	LogFile  string `json:"LogFile"`  // 日志文件路径
-	RpAddr   string `json:"RpAddr"`   // 反向代理目标地址
-	RpPath   string `json:"RpPath"`   // 反向代理路径
-	CfHeader string `json:"CfHeader"` // 自定义请求头标识
+	CertFile     string   `json:"CertFile"`     // TLS 证书文件路径
+	KeyFile      string   `json:"KeyFile"`      // TLS 私钥文件路径
+	LogFile      string   `json:"LogFile"`      // 日志文件路径
+	RpAddr       string   `json:"RpAddr"`       // 反向代理目标地址，"unix:/run/backend.sock" 表示转发到 Unix 套接字
+	RpAddrs      []string `json:"RpAddrs"`      // 多个反向代理目标地址，轮询负载均衡
+	RpPath       string   `json:"RpPath"`       // 反向代理路径
+	RpPaths      []string `json:"RpPaths"`      // 多个反向代理路径，任意一个匹配即可
+	CfHeader     string   `json:"CfHeader"`     // 自定义请求头标识
+	CfHeaderName string   `json:"CfHeaderName"` // 携带请求头标识的请求头名称，默认 "x-flag"
+	CfHeaders    []string `json:"CfHeaders"`    // 多个有效的请求头标识（如密钥轮换期间新旧并存），任意一个匹配即可
+	Routes       []Route  `json:"Routes"`       // 按路由转发到不同目标，非空时取代 RpAddr/RpPath/CfHeader
+
+	LogFormat     string `json:"LogFormat"`     // 访问日志格式："text"（默认，竖线分隔）、"json"（每行一个 JSON 对象）或 "combined"（Apache Combined Log Format）
+	LogMaxSizeMB  int    `json:"LogMaxSizeMB"`  // 日志文件超过该大小（MB）时轮转，0 表示不轮转
+	LogMaxBackups int    `json:"LogMaxBackups"` // 轮转后保留的历史文件个数（<file>.1 ... <file>.N）
+
+	LogFallbackStderr *bool `json:"LogFallbackStderr"` // 日志文件无法打开时改为输出到 stderr，默认 true；设为 false 时直接退出
+
+	AccessLogFile string `json:"AccessLogFile"` // 访问日志单独写入的文件，为空时与程序日志共用 LogFile；轮转参数与 LogFile 相同
+
+	LogTarget  string `json:"LogTarget"`  // 日志输出位置："file"（默认，写入 LogFile）、"stdout" 或 "syslog"
+	SyslogAddr string `json:"SyslogAddr"` // 远程 syslog 地址（如 "udp://10.0.0.1:514"、"tcp://log:601"），为空时写入本机 syslog
+
+	LogSampleRate *float64 `json:"LogSampleRate"` // 成功请求的访问日志采样比例（0–1），未设置时全部记录；错误和被拒绝的请求始终记录
+
+	ShutdownTimeout       Duration `json:"ShutdownTimeout"`       // 优雅关闭时等待请求完成的最长时间，默认 15s
+	WebSocketDrainTimeout Duration `json:"WebSocketDrainTimeout"` // 优雅关闭时等待 WebSocket 连接自行关闭的时间，超时后强制关闭，默认 5s
+	HTTPRedirectAddr      string   `json:"HTTPRedirectAddr"`      // HTTP 跳转 HTTPS 的监听地址（如 ":80"），为空则不启用
+	PathPrefixMatch       bool     `json:"PathPrefixMatch"`       // 按前缀匹配路径，"/api" 可匹配 "/api/users"；默认精确匹配
+	WebSocketPaths        []string `json:"WebSocketPaths"`        // WebSocket 升级请求额外允许的路径，匹配规则同 RpPaths
+	HealthPath            string   `json:"HealthPath"`            // 健康检查路径（如 "/healthz"），不校验请求头也不转发
+	MetricsPath           string   `json:"MetricsPath"`           // Prometheus 指标路径（如 "/metrics"），不校验请求头，为空则不启用
+
+	ReadTimeout       Duration `json:"ReadTimeout"`       // 读取整个请求的超时时间，默认 5s
+	ReadHeaderTimeout Duration `json:"ReadHeaderTimeout"` // 读取请求头的超时时间，防御 slowloris，默认与 ReadTimeout 相同
+	WriteTimeout      Duration `json:"WriteTimeout"`      // 写入响应的超时时间，默认 10s，大文件下载需调大
+	IdleTimeout       Duration `json:"IdleTimeout"`       // keep-alive 空闲连接超时时间，默认 120s
+
+	CertCheckInterval Duration `json:"CertCheckInterval"` // 检查证书文件是否更新的间隔，默认 1m
+
+	TLSMinVersion string   `json:"TLSMinVersion"` // 最低 TLS 版本（"1.0"~"1.3"），默认 1.2
+	TLSMaxVersion string   `json:"TLSMaxVersion"` // 最高 TLS 版本，默认不限制
+	CipherSuites  []string `json:"CipherSuites"`  // 允许的加密套件名称，默认使用 Go 的安全套件
+
+	EnableHTTP3 bool `json:"EnableHTTP3"` // 在同一端口的 UDP 上提供 HTTP/3（QUIC）
+
+	ClientCAFile      string `json:"ClientCAFile"`      // 校验客户端证书的 CA 文件
+	RequireClientCert bool   `json:"RequireClientCert"` // 要求客户端必须提供由 ClientCAFile 签发的证书（双向 TLS）
+
+	ACMEDomains  []string `json:"ACMEDomains"`  // 通过 Let's Encrypt 自动申请证书的域名，设置后忽略 CertFile/KeyFile
+	ACMECacheDir string   `json:"ACMECacheDir"` // ACME 证书缓存目录，默认 /var/lib/goweb/acme
+	ACMEEmail    string   `json:"ACMEEmail"`    // ACME 账号联系邮箱，可选
+
+	NotFoundBody   string `json:"NotFoundBody"`   // 拒绝请求时返回的 JSON 内容，或 JSON 文件路径，为空使用默认内容
+	NotFoundStatus int    `json:"NotFoundStatus"` // 拒绝请求时返回的状态码，默认 404
+	BadGatewayBody string `json:"BadGatewayBody"` // 上游出错时返回的 502 JSON 内容，或 JSON 文件路径，为空使用默认内容
+
+	MaxRequestBytes int64 `json:"MaxRequestBytes"` // 请求体最大字节数，超过返回 413，0 表示不限制
+	MaxHeaderBytes  int   `json:"MaxHeaderBytes"`  // 请求行和请求头的最大字节数，超过返回 431，默认 1MB
+
+	AllowCIDRs []string `json:"AllowCIDRs"` // 允许访问的客户端网段，为空表示允许所有
+	DenyCIDRs  []string `json:"DenyCIDRs"`  // 拒绝访问的客户端网段，优先于 AllowCIDRs
+
+	RateLimitRPS   float64 `json:"RateLimitRPS"`   // 每个客户端 IP 每秒允许的请求数，0 表示不限流
+	RateLimitBurst int     `json:"RateLimitBurst"` // 令牌桶容量，允许的突发请求数
+
+	AddRequestHeaders    map[string]string `json:"AddRequestHeaders"`    // 转发到上游前添加/覆盖的请求头
+	RemoveRequestHeaders []string          `json:"RemoveRequestHeaders"` // 转发到上游前移除的请求头（如 "x-flag"）
+	AddResponseHeaders   map[string]string `json:"AddResponseHeaders"`   // 返回给客户端前添加/覆盖的响应头
+
+	CheckUpstreamOnStart bool     `json:"CheckUpstreamOnStart"` // 启动时检查上游是否可达，不可达时记录警告
+	FailFastOnUpstream   bool     `json:"FailFastOnUpstream"`   // 上游不可达时直接退出（隐含 CheckUpstreamOnStart）
+	UpstreamCheckTimeout Duration `json:"UpstreamCheckTimeout"` // 启动检查连接上游的超时时间，默认 5s
+
+	MaxRetries    int      `json:"MaxRetries"`    // 上游连接失败时幂等请求（GET/HEAD）的最大重试次数，0 表示不重试
+	RetryBackoff  Duration `json:"RetryBackoff"`  // 首次重试前的等待时间，之后每次翻倍，默认 100ms
+	RetryOnStatus []int    `json:"RetryOnStatus"` // 上游返回这些状态码（如 503）时重试幂等请求（GET/HEAD/PUT/DELETE/OPTIONS），次数同 MaxRetries
+
+	TrustedProxies []string `json:"TrustedProxies"` // 可信的前置代理网段，来自这些地址的请求才信任其 X-Forwarded-For
+
+	Compression CompressionConfig `json:"Compression"` // 代理响应的 gzip/brotli 压缩配置
+
+	MaxIdleConns        int      `json:"MaxIdleConns"`        // 到所有上游的最大空闲连接数，默认 100
+	MaxIdleConnsPerHost int      `json:"MaxIdleConnsPerHost"` // 到单个上游的最大空闲连接数，默认 100
+	IdleConnTimeout     Duration `json:"IdleConnTimeout"`     // 上游空闲连接的保留时间，默认 90s
+
+	AllowedMethods []string `json:"AllowedMethods"` // 允许转发的请求方法（如 GET、POST），为空表示允许所有
+
+	Version      int   `json:"Version"`      // 配置文件格式版本，未设置时按当前版本处理，高于程序支持的版本时拒绝加载
+	StrictConfig *bool `json:"StrictConfig"` // 配置文件包含未知字段时拒绝加载，默认 true；设为 false 时只记录警告
+
+	CircuitBreakerFailures int      `json:"CircuitBreakerFailures"` // 窗口内连续失败达到该次数后熔断，0 表示不启用
+	CircuitBreakerWindow   Duration `json:"CircuitBreakerWindow"`   // 统计连续失败的时间窗口，默认 10s
+	CircuitBreakerCooldown Duration `json:"CircuitBreakerCooldown"` // 熔断后直接返回 503 的时长，之后放行一个请求试探恢复，默认 30s
+
+	HealthCheckPath               string   `json:"HealthCheckPath"`               // 上游健康检查路径（如 "/healthz"），为空则不做主动健康检查
+	HealthCheckInterval           Duration `json:"HealthCheckInterval"`           // 健康检查间隔，默认 10s
+	HealthCheckUnhealthyThreshold int      `json:"HealthCheckUnhealthyThreshold"` // 连续失败多少次后将目标移出轮询，默认 3
+
+	BasicAuthUser string `json:"BasicAuthUser"` // Basic Auth 用户名，设置后带正确凭据的请求可代替请求头标识
+	BasicAuthPass string `json:"BasicAuthPass"` // Basic Auth 密码
+
+	JWTAuth JWTAuthConfig `json:"JWTAuth"` // JWT 认证，启用后只有带有效 Bearer Token 的请求才会转发
+
+	UpstreamTimeout Duration `json:"UpstreamTimeout"` // 等待上游响应头的最长时间（含重试），超时返回 504，为空不限制
+
+	HandlerTimeout             Duration `json:"HandlerTimeout"`             // 转发一个请求（含读取上游响应）的总时间上限，超时返回 503，为空不限制；响应会被完整缓冲
+	HandlerTimeoutExcludePaths []string `json:"HandlerTimeoutExcludePaths"` // 不受 HandlerTimeout 限制的路径（如流式接口），规则同 RpPaths；WebSocket 和 SSE 请求总是不受限制
+
+	CORS CORSConfig `json:"CORS"` // 跨域资源共享，为浏览器客户端应答预检请求并添加 Access-Control-* 响应头
+
+	SecurityHeaders SecurityHeadersConfig `json:"SecurityHeaders"` // 安全响应头（HSTS、nosniff、X-Frame-Options、CSP）
+
+	StripPrefix bool        `json:"StripPrefix"` // 转发前去掉匹配到的 RpPath/路由路径前缀，"/api/users" 转发为 "/users"
+	RewritePath PathRewrite `json:"RewritePath"` // 转发前改写路径，在 StripPrefix 之后应用
+
+	AdminToken      string `json:"AdminToken"`      // 管理接口的访问令牌，请求需带 Authorization: Bearer <AdminToken>
+	EnablePprof     bool   `json:"EnablePprof"`     // 在 /debug/pprof/ 提供性能分析接口，需要 AdminToken
+	AdminReloadPath string `json:"AdminReloadPath"` // 通过 POST 重载配置的管理接口路径（如 "/admin/reload"），为空不启用，需要 AdminToken
+
+	ClientIPHeader string `json:"ClientIPHeader"` // 可信代理传递客户端 IP 的请求头（如 "CF-Connecting-IP"），只在对端属于 TrustedProxies 时使用
+
+	MaintenanceMode       bool     `json:"MaintenanceMode"`       // 维护模式，开启后不再转发，返回 503 和维护页面，可通过重载切换
+	MaintenanceFile       string   `json:"MaintenanceFile"`       // 维护页面 HTML 文件，为空时返回 JSON；重载时重新读取
+	MaintenanceRetryAfter Duration `json:"MaintenanceRetryAfter"` // 维护期间 Retry-After 响应头的时长，默认 5m
+
+	CacheMaxEntries int      `json:"CacheMaxEntries"` // GET 响应缓存的最大条目数，0 表示不缓存
+	CacheDefaultTTL Duration `json:"CacheDefaultTTL"` // 上游未通过 Cache-Control 指定缓存时间时使用的时长，为空则只缓存明确允许的响应
+
+	VerboseRejections bool `json:"VerboseRejections"` // 在访问日志和 404 响应中给出拒绝原因（路径或请求头不匹配），仅用于调试
+
+	ListenAddr string `json:"ListenAddr"` // 主服务监听地址，默认 ":443"；"unix:/run/goweb.sock" 表示监听 Unix 套接字（不使用 TLS）
+
+	OTLPEndpoint string `json:"OTLPEndpoint"` // OpenTelemetry OTLP/HTTP 导出地址（如 "http://otel-collector:4318"），为空不启用追踪
+
+	RpTargets []WeightedTarget `json:"RpTargets"` // 带权重的反向代理目标，设置后代替 RpAddr/RpAddrs，按平滑加权轮询分发
+
+	Stickiness    string `json:"Stickiness"`    // 会话保持："ip" 按客户端 IP 哈希，"cookie" 用 Cookie 固定目标，"consistent-hash" 按一致性哈希（增删目标时只影响少量 key），为空时按轮询分发
+	HashKeyHeader string `json:"HashKeyHeader"` // consistent-hash 模式下作为 key 的请求头（如 "X-User-ID"），为空或请求头缺失时使用客户端 IP
+
+	FlushInterval Duration `json:"FlushInterval"` // 代理响应刷新到客户端的间隔，"-1" 表示每次写入后立即刷新；text/event-stream 响应总是立即刷新
+
+	MaxConcurrentRequests   int      `json:"MaxConcurrentRequests"`   // 同时转发的最大请求数，0 表示不限制
+	ConcurrencyQueueTimeout Duration `json:"ConcurrencyQueueTimeout"` // 达到上限时排队等待的最长时间，超时返回 503；为空时立即返回 503
+
+	Hosts map[string]string `json:"Hosts"` // 虚拟主机：按请求的主机名（Host/SNI）转发到不同目标，未列出的主机返回 404；设置后代替 RpAddr/RpAddrs
+
+	DebugBodyLog       bool     `json:"DebugBodyLog"`       // 调试用：记录转发的请求体和响应体，不改变实际传输的内容，生产环境不要开启
+	DebugBodyMaxBytes  int      `json:"DebugBodyMaxBytes"`  // 每个请求体/响应体最多记录的字节数，默认 4096
+	DebugRedactHeaders []string `json:"DebugRedactHeaders"` // 调试日志中额外隐藏的请求头/响应头，Authorization、Cookie 和各个 CfHeaderName 总是隐藏
+
+	AdminDrainPath string `json:"AdminDrainPath"` // 下线管理接口路径（如 "/admin/drain"），POST 后 HealthPath 返回 503，DELETE 恢复；需要 AdminToken
+
+	PreserveHost bool `json:"PreserveHost"` // 转发时保留客户端请求的 Host，默认改为代理目标的主机；两种情况下 X-Forwarded-Host 都是客户端的原始 Host
+
+	WatchConfig bool `json:"WatchConfig"` // 监听配置文件，修改后自动重载（无效时保留旧配置），只支持本地文件
+
+	LogTLS bool `json:"LogTLS"` // 访问日志记录协商的 TLS 版本、加密套件和 SNI 主机名，用于安全审计
+
+	DisableHTTP2 bool `json:"DisableHTTP2"` // 禁用 HTTP/2，只通过 HTTP/1.1 提供服务（用于规避客户端的 HTTP/2 问题）
+
+	BackendRedirectHeader string `json:"BackendRedirectHeader"` // 上游故障转移响应头（如 "X-Backend-Redirect"），值为另一个已配置上游的地址时改为向其重新发送请求
+	MaxBackendRedirects   int    `json:"MaxBackendRedirects"`   // 单个请求最多跟随的上游转移次数，超过返回 502，默认 3
+
+	LivenessPath  string `json:"LivenessPath"`  // 存活探针路径（如 "/livez"），进程运行即返回 200，不校验请求头也不转发
+	ReadinessPath string `json:"ReadinessPath"` // 就绪探针路径（如 "/readyz"），上游通过健康检查（配置了 HealthCheckPath 时）且未处于 draining 才返回 200
+
+	RpAddrBackup string `json:"RpAddrBackup"` // 备用上游地址，主上游连接失败时幂等请求（GET/HEAD）改发到这里一次
+
+	CanaryTarget      string `json:"CanaryTarget"`      // 金丝雀目标地址，请求带有 CanaryHeader 或被 CanaryPercent 选中时转发到这里（Routes/Hosts 选定的请求除外）
+	CanaryHeader      string `json:"CanaryHeader"`      // 选择金丝雀目标的请求头名称（如 "X-Canary"）
+	CanaryHeaderValue string `json:"CanaryHeaderValue"` // CanaryHeader 需要匹配的值，默认 "true"
+
+	CanaryPercent float64 `json:"CanaryPercent"` // 随机转发到 CanaryTarget 的请求百分比（0-100），与 CanaryHeader 可同时使用
+
+	LogHeaders []string `json:"LogHeaders"` // 追加记录到访问日志的请求头（如 "X-Tenant-ID"），空值记为 "-"
+
+	LogTimeFormat string `json:"LogTimeFormat"` // 访问日志的时间格式："rfc3339"（默认）、"rfc3339nano"、"iso8601"、"legacy"（旧的 12 小时制）或 Go 时间布局；combined 格式不受影响
+
+	UpstreamCAFile             string `json:"UpstreamCAFile"`             // 校验 HTTPS 上游证书的 CA 文件（PEM），代替系统根证书，用于私有 CA
+	UpstreamInsecureSkipVerify bool   `json:"UpstreamInsecureSkipVerify"` // 不校验 HTTPS 上游的证书，仅用于开发环境
+
+	MaxConnsPerIP int `json:"MaxConnsPerIP"` // 单个客户端 IP 同时处理的最大请求数，超过返回 429，0 表示不限制
+
+	ResponseRewrite []ResponseRewrite `json:"ResponseRewrite"` // 按顺序改写上游响应内容的规则（如替换内部主机名），支持 gzip 响应
+
+	AdminConfigPath string `json:"AdminConfigPath"` // 以 JSON 返回当前生效配置的管理接口路径（如 "/admin/config"），密钥等敏感字段会隐藏；需要 AdminToken
+
+	HTTPListenAddr string `json:"HTTPListenAddr"` // 以明文 HTTP 提供同样代理服务的监听地址（如 ":8080"，用于前置负载均衡器已终止 TLS 的场景），为空不启用；不能与 RequireClientCert 同时使用
+
+	GeoDBPath        string   `json:"GeoDBPath"`        // MaxMind mmdb 国家数据库路径（如 GeoLite2-Country.mmdb），按客户端 IP 所在国家做访问控制，修改需重启
+	AllowedCountries []string `json:"AllowedCountries"` // 允许访问的国家代码（ISO 3166-1，如 "CN"），为空表示允许所有；设置后查不到国家的地址（如内网地址）也会被拒绝，需要 GeoDBPath
+	BlockedCountries []string `json:"BlockedCountries"` // 拒绝访问的国家代码，优先于 AllowedCountries，需要 GeoDBPath
+
+	ErrorResponses map[string]ErrorResponse `json:"ErrorResponses"` // 按状态码（如 "502"）或类别（"4xx"、"5xx"）替换上游错误响应和代理错误的内容，精确状态码优先
+
+	LogBufferSize int `json:"LogBufferSize"` // 访问日志的写入缓冲区字节数（如 65536），每秒及关闭时写出，0 表示不缓冲；修改需重启
+
+	EnableProxyProtocol bool `json:"EnableProxyProtocol"` // 解析前置负载均衡器（如 AWS NLB）发送的 PROXY 协议头（v1/v2），以其中的客户端地址作为 RemoteAddr；需要配置 TrustedProxies，只接受这些网段的连接且必须带协议头；只作用于主监听，修改需重启
+
+	notFoundBody    string                   // 由 NotFoundBody 解析得到的响应内容
+	badGatewayBody  string                   // 由 BadGatewayBody 解析得到的响应内容
+	errorResponses  map[string]ErrorResponse // 由 ErrorResponses 解析得到的模板，键已转为小写
+	trustedNets     []*net.IPNet             // 由 TrustedProxies 解析得到的网段
+	rewriteRe       *regexp.Regexp           // 由 RewritePath.From 编译得到的正则（Regex 模式）
+	maintenancePage []byte                   // 由 MaintenanceFile 读取的维护页面内容
 }
 
-// loadConfig
-func loadConfig() Config {
-	// 从配置文件或环境变量加载配置
-	return Config{
-		CertFile: config.CertFile,
-		KeyFile:  config.KeyFile,
-		LogFile:  config.LogFile,
-		RpAddr:   config.RpAddr,
-		RpPath:   config.RpPath,
-		CfHeader: config.CfHeader,
+// defaultNotFoundBody 未配置 NotFoundBody 时拒绝请求返回的内容
+const defaultNotFoundBody = `{"error": "not found", "message": "The requested resource is not available"}`
+
+// defaultBadGatewayBody 未配置 BadGatewayBody 时上游出错返回的内容
+const defaultBadGatewayBody = `{"error": "bad gateway", "message": "The upstream service is unavailable"}`
+
+// defaultShutdownTimeout 未配置 ShutdownTimeout 时使用的默认值
+const defaultShutdownTimeout = 15 * time.Second
+
+// defaultWebSocketDrainTimeout 未配置 WebSocketDrainTimeout 时使用的默认值
+const defaultWebSocketDrainTimeout = 5 * time.Second
+
+// 服务器超时的默认值
+const (
+	defaultReadTimeout  = 5 * time.Second
+	defaultWriteTimeout = 10 * time.Second
+	defaultIdleTimeout  = 120 * time.Second
+)
+
+// Duration 支持在 JSON 中以 "30s"、"1m" 这样的字符串表示时间间隔
+type Duration time.Duration
+
+// UnmarshalJSON 解析 Go duration 格式的字符串，"-1" 表示负值（如 FlushInterval 的立即刷新）
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	if s == "-1" {
+		*d = -1
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON 以与配置文件相同的字符串格式输出（如管理接口返回的配置）
+func (d Duration) MarshalJSON() ([]byte, error) {
+	if d == -1 {
+		return json.Marshal("-1")
+	}
+	return json.Marshal(time.Duration(d).String())
+}
+
+// certCheckInterval 返回检查证书文件更新的间隔
+func (c Config) certCheckInterval() time.Duration {
+	if c.CertCheckInterval <= 0 {
+		return defaultCertCheckInterval
+	}
+	return time.Duration(c.CertCheckInterval)
+}
+
+// retryBackoff 返回首次重试前的等待时间
+func (c Config) retryBackoff() time.Duration {
+	if c.RetryBackoff <= 0 {
+		return defaultRetryBackoff
+	}
+	return time.Duration(c.RetryBackoff)
+}
+
+// upstreamAddrs 返回所有上游地址：配置了 Routes 时为各路由目标，配置了 Hosts 时为各主机目标，否则为 targetAddrs
+func (c Config) upstreamAddrs() []string {
+	if len(c.Hosts) > 0 {
+		addrs := make([]string, 0, len(c.Hosts))
+		for _, target := range c.Hosts {
+			addrs = append(addrs, target)
+		}
+		return addrs
+	}
+	if len(c.Routes) == 0 {
+		return c.targetAddrs()
+	}
+	addrs := make([]string, 0, len(c.Routes))
+	for _, route := range c.Routes {
+		addrs = append(addrs, route.Target)
+	}
+	return addrs
+}
+
+// defaultCfHeaderName 未配置 CfHeaderName 时使用的请求头名称
+const defaultCfHeaderName = "x-flag"
+
+// cfHeaderName 返回携带请求头标识的请求头名称
+func (c Config) cfHeaderName() string {
+	if c.CfHeaderName == "" {
+		return defaultCfHeaderName
+	}
+	return c.CfHeaderName
+}
+
+// cfHeaderAllowed 判断请求头标识是否匹配 CfHeaders 中任意一个，CfHeaders 为空时退回到单个 CfHeader
+func (c Config) cfHeaderAllowed(value string) bool {
+	values := c.CfHeaders
+	if len(values) == 0 {
+		values = []string{c.CfHeader}
+	}
+	ok := false
+	for _, want := range values {
+		// 不提前退出，避免通过耗时推测命中了哪一个
+		if secretEqual(value, want) {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// basicAuthAllowed 判断请求是否带有正确的 Basic Auth 凭据，未配置 BasicAuthUser 时始终为 false
+func (c Config) basicAuthAllowed(r *http.Request) bool {
+	if c.BasicAuthUser == "" {
+		return false
+	}
+	user, pass, ok := r.BasicAuth()
+	// 用户名和密码都比较完，避免通过耗时推测哪一项错误
+	userOK := secretEqual(user, c.BasicAuthUser)
+	passOK := secretEqual(pass, c.BasicAuthPass)
+	return ok && userOK && passOK
+}
+
+// secretEqual 以常量时间比较密钥，避免计时侧信道
+func secretEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// pathAllowed 判断请求路径是否允许转发，RpPaths 为空时退回到单个 RpPath
+// 默认精确匹配；开启 PathPrefixMatch 后按路径段前缀匹配，"/api" 匹配 "/api/users" 但不匹配 "/apix"
+func (c Config) pathAllowed(path string) bool {
+	paths := c.RpPaths
+	if len(paths) == 0 {
+		paths = []string{c.RpPath}
+	}
+	return c.matchPath(paths, path)
+}
+
+// matchedPath 返回请求命中的 RpPath/RpPaths（WebSocket 握手还包括 WebSocketPaths）中最长的一项，未命中返回空
+func (c Config) matchedPath(r *http.Request) string {
+	paths := c.RpPaths
+	if len(paths) == 0 {
+		paths = []string{c.RpPath}
+	}
+	if isWebSocketUpgrade(r) {
+		paths = append(paths[:len(paths):len(paths)], c.WebSocketPaths...)
+	}
+	matched := ""
+	for _, p := range paths {
+		if c.matchPath([]string{p}, r.URL.Path) && len(p) > len(matched) {
+			matched = p
+		}
+	}
+	return matched
+}
+
+// webSocketPathAllowed 判断 WebSocket 升级请求的路径是否允许转发
+func (c Config) webSocketPathAllowed(path string) bool {
+	return c.pathAllowed(path) || c.matchPath(c.WebSocketPaths, path)
+}
+
+// matchPath 按 PathPrefixMatch 规则判断路径是否命中列表中的任意一项
+func (c Config) matchPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if path == p {
+			return true
+		}
+		if c.PathPrefixMatch && strings.HasPrefix(path, strings.TrimSuffix(p, "/")+"/") {
+			return true
+		}
 	}
+	return false
 }
 
-// loadFile 从指定路径加载配置文件
-func loadFile(path string) {
-	file, err := os.Open(path)
+// resolve 计算由配置项派生的内部字段，加载配置时调用一次，避免每个请求重复解析
+func (c *Config) resolve() error {
+	if c.NotFoundStatus != 0 && (c.NotFoundStatus < 100 || c.NotFoundStatus > 599) {
+		return fmt.Errorf("NotFoundStatus %d is not a valid HTTP status code", c.NotFoundStatus)
+	}
+
+	var err error
+	if c.notFoundBody, err = loadJSONBody("NotFoundBody", c.NotFoundBody, defaultNotFoundBody); err != nil {
+		return err
+	}
+	if c.badGatewayBody, err = loadJSONBody("BadGatewayBody", c.BadGatewayBody, defaultBadGatewayBody); err != nil {
+		return err
+	}
+	if c.errorResponses, err = resolveErrorResponses(c.ErrorResponses); err != nil {
+		return err
+	}
+
+	nets, err := parseCIDRs(c.TrustedProxies)
 	if err != nil {
-		log.Fatal("Failed to open Config file:", err)
-		return
+		return fmt.Errorf("TrustedProxies: %w", err)
+	}
+	c.trustedNets = nets
+
+	if c.MaintenanceFile != "" {
+		if c.maintenancePage, err = os.ReadFile(c.MaintenanceFile); err != nil {
+			return fmt.Errorf("MaintenanceFile: %w", err)
+		}
 	}
-	defer file.Close() // 确保文件关闭
 
-	// 解析 JSON 文件内容到 config 结构体
-	decoder := json.NewDecoder(file)
-	err = decoder.Decode(&config)
+	if c.RewritePath.Regex {
+		if c.rewriteRe, err = regexp.Compile(c.RewritePath.From); err != nil {
+			return fmt.Errorf("RewritePath.From: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadJSONBody 解析响应内容配置：为空使用默认内容，合法 JSON 直接使用，否则视为文件路径读取
+// 加载时校验内容必须是合法 JSON，避免对外返回错误格式的响应
+func loadJSONBody(field, value, def string) (string, error) {
+	if value == "" {
+		return def, nil
+	}
+	if json.Valid([]byte(value)) {
+		return value, nil
+	}
+	b, err := os.ReadFile(value)
 	if err != nil {
-		log.Fatal("解析 JSON 失败:", err)
-		return
+		return "", fmt.Errorf("%s is neither valid JSON nor a readable file: %w", field, err)
 	}
+	if !json.Valid(b) {
+		return "", fmt.Errorf("%s file %s does not contain valid JSON", field, value)
+	}
+	return string(b), nil
+}
+
+// notFoundStatus 返回拒绝请求时使用的状态码
+func (c Config) notFoundStatus() int {
+	if c.NotFoundStatus == 0 {
+		return http.StatusNotFound
+	}
+	return c.NotFoundStatus
+}
+
+// or 返回配置的时间间隔，未配置（<=0）时返回默认值
+func (d Duration) or(def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return time.Duration(d)
+}
+
+// sampleAccessLog 按 LogSampleRate 决定是否记录本次请求，状态码 >= 400（错误和被拒绝的请求）始终记录
+func (c Config) sampleAccessLog(status int) bool {
+	if c.LogSampleRate == nil || status >= 400 {
+		return true
+	}
+	return rand.Float64() < *c.LogSampleRate
+}
+
+// logFallbackStderr 返回日志文件打开失败时是否改用 stderr，未配置时默认开启
+func (c Config) logFallbackStderr() bool {
+	return c.LogFallbackStderr == nil || *c.LogFallbackStderr
+}
+
+// strictConfig 判断是否拒绝未知的配置字段，未设置时默认为 true
+func (c Config) strictConfig() bool {
+	return c.StrictConfig == nil || *c.StrictConfig
+}
+
+// methodAllowed 判断请求方法是否允许转发，AllowedMethods 为空时允许所有方法
+func (c Config) methodAllowed(method string) bool {
+	if len(c.AllowedMethods) == 0 {
+		return true
+	}
+	for _, m := range c.AllowedMethods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// shutdownTimeout 返回优雅关闭的等待时间
+func (c Config) shutdownTimeout() time.Duration {
+	if c.ShutdownTimeout <= 0 {
+		return defaultShutdownTimeout
+	}
+	return time.Duration(c.ShutdownTimeout)
+}
+
+// webSocketDrainTimeout 返回优雅关闭时等待 WebSocket 连接的时间
+func (c Config) webSocketDrainTimeout() time.Duration {
+	if c.WebSocketDrainTimeout <= 0 {
+		return defaultWebSocketDrainTimeout
+	}
+	return time.Duration(c.WebSocketDrainTimeout)
+}
+
+// targets 返回代理目标及其权重：优先使用 RpTargets，其次 RpAddrs，最后是单个 RpAddr，后两者权重均为 1
+func (c Config) targets() []WeightedTarget {
+	if len(c.RpTargets) > 0 {
+		return c.RpTargets
+	}
+	addrs := c.RpAddrs
+	if len(addrs) == 0 {
+		addrs = []string{c.RpAddr}
+	}
+	targets := make([]WeightedTarget, 0, len(addrs))
+	for _, addr := range addrs {
+		targets = append(targets, WeightedTarget{Addr: addr, Weight: 1})
+	}
+	return targets
+}
+
+// targetAddrs 返回代理目标地址列表
+func (c Config) targetAddrs() []string {
+	targets := c.targets()
+	addrs := make([]string, 0, len(targets))
+	for _, t := range targets {
+		addrs = append(addrs, t.Addr)
+	}
+	return addrs
+}
+
+// loadConfig 返回当前生效配置的副本，可在请求处理中并发调用
+func loadConfig() Config {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return config
+}
+
+// loadFile 从指定路径加载配置文件，再用环境变量覆盖（优先级见 applyEnv）
+// 路径也可以是 "-"（标准输入）或 http(s):// 地址，见 readConfigSource；只有一个本地配置文件且不存在时只使用环境变量
+// 逗号分隔的多个来源按顺序合并，如 "base.json,prod.json"，规则见 mergeConfig；此时任何一个文件不存在都视为错误，
+// 避免覆盖文件名写错时静默使用基础配置
+func loadFile(path string) (Config, error) {
+	var c Config
+	var sources [][]byte
+	paths := splitConfigPaths(path)
+	for _, p := range paths {
+		data, err := readConfigSource(p)
+		switch {
+		case os.IsNotExist(err) && len(paths) > 1:
+			return c, fmt.Errorf("Config file %s not found", p)
+		case os.IsNotExist(err):
+			log.Printf("Config file %s not found, using environment variables only", p)
+		case err != nil:
+			return c, err
+		default:
+			// 每个文件单独解析，再把其中的非零字段合并到前面的结果上
+			var fc Config
+			if err := json.Unmarshal(data, &fc); err != nil {
+				return c, fmt.Errorf("解析 JSON 失败 (%s): %w", p, err)
+			}
+			mergeConfig(&c, fc)
+			sources = append(sources, data)
+		}
+	}
+
+	if err := applyEnv(&c); err != nil {
+		return c, err
+	}
+	// 在环境变量覆盖之后检查，GOWEB_STRICTCONFIG 也能关闭严格模式
+	for _, data := range sources {
+		if err := migrateConfig(&c, data); err != nil {
+			return c, err
+		}
+	}
+	if err := c.resolve(); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// openLogFile 以追加模式打开日志文件
+func openLogFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+}
+
+// accessEntry 一条访问日志记录，JSON 模式下的字段名与文本模式的列一一对应
+type accessEntry struct {
+	Time       string  `json:"time"`
+	URI        string  `json:"uri"`
+	UserAgent  string  `json:"user_agent"`
+	ClientIP   string  `json:"client_ip"`
+	CfHeader   string  `json:"cf_header"`
+	RemoteAddr string  `json:"remote_addr"`
+	ClientCN   string  `json:"client_cn"`
+	RequestID  string  `json:"request_id"`
+	Status     int     `json:"status"`
+	Bytes      int64   `json:"bytes"`
+	Cache      string  `json:"cache,omitempty"`
+	Reason     string  `json:"reason,omitempty"`
+	Variant    string  `json:"variant,omitempty"`
+	Listener   string  `json:"listener,omitempty"` // 只在配置了 HTTPListenAddr 时记录："https" 或 "http"
+	DurationMs float64 `json:"duration_ms"`
+
+	// LogHeaders 中请求头的值，空值记为 "-"；headerValues 按配置顺序用于文本和 combined 格式
+	Headers      map[string]string `json:"headers,omitempty"`
+	headerValues []string
+
+	// 以下字段只在 LogTLS 时记录
+	TLSVersion  string `json:"tls_version,omitempty"`
+	CipherSuite string `json:"cipher_suite,omitempty"`
+	ServerName  string `json:"sni,omitempty"`
+
+	// 以下字段只用于 combined 格式
+	IP      string `json:"-"`
+	Method  string `json:"-"`
+	Proto   string `json:"-"`
+	Referer string `json:"-"`
 }
 
 // logFormat 格式化日志输出
-func logFormat(tip string, uri string, ag string, ip string, cf string) {
-	// 日志格式：{datetime|uri|user-agent|header|tip|ip}
-	log.Printf("|%s|%s|%s|%s|%s|%s\n", time.Now().Format("2006/01/02 03:04:05 PM -0700"), uri, ag, cf, tip, ip)
+func logFormat(e accessEntry) {
+	if logMode == "combined" {
+		// ip - - [time] "METHOD uri proto" status bytes "referer" "user-agent"
+		bytes := "-"
+		if e.Bytes > 0 {
+			bytes = strconv.FormatInt(e.Bytes, 10)
+		}
+		// LogHeaders 的值按顺序追加在末尾
+		var extra strings.Builder
+		for _, v := range e.headerValues {
+			extra.WriteString(" " + combinedQuote(v))
+		}
+		fmt.Fprintf(accessLog.Writer(), "%s - - [%s] \"%s %s %s\" %d %s %s %s%s\n",
+			e.IP, time.Now().Format("02/Jan/2006:15:04:05 -0700"), e.Method, e.URI, e.Proto,
+			e.Status, bytes, combinedQuote(e.Referer), combinedQuote(e.UserAgent), extra.String())
+		return
+	}
+
+	e.Time = time.Now().Format(logTimeLayout)
+
+	if logMode == "json" {
+		// JSON 模式不带 log 包的前缀，保证每行都是完整的 JSON 对象
+		b, err := json.Marshal(e)
+		if err != nil {
+			log.Println("Failed to encode access log:", err)
+			return
+		}
+		accessLog.Writer().Write(append(b, '\n'))
+		return
+	}
+
+	// 日志格式：{datetime|uri|user-agent|header|tip|ip|client-cn|request-id|status|bytes|cache|reason|variant|duration-ms}
+	// 之后依次追加 LogHeaders 的值，配置了 HTTPListenAddr 时追加 {listener}，LogTLS 时再追加 {tls-version|cipher-suite|sni}
+	line := fmt.Sprintf("|%s|%s|%s|%s|%s|%s|%s|%s|%d|%d|%s|%s|%s|%.3f", e.Time, e.URI, e.UserAgent, e.CfHeader, e.RemoteAddr, e.ClientIP, e.ClientCN, e.RequestID, e.Status, e.Bytes, e.Cache, e.Reason, e.Variant, e.DurationMs)
+	for _, v := range e.headerValues {
+		line += "|" + v
+	}
+	if e.Listener != "" {
+		line += "|" + e.Listener
+	}
+	if e.TLSVersion != "" {
+		line += "|" + e.TLSVersion + "|" + e.CipherSuite + "|" + e.ServerName
+	}
+	accessLog.Println(line)
+}
+
+// legacyLogTimeLayout 早期版本使用的 12 小时制时间格式，按字符串排序时顺序不正确
+const legacyLogTimeLayout = "2006/01/02 03:04:05 PM -0700"
+
+// logTimeLayouts LogTimeFormat 可用的预设名称
+var logTimeLayouts = map[string]string{
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"iso8601":     "2006-01-02T15:04:05.000Z07:00",
+	"legacy":      legacyLogTimeLayout,
+}
+
+// logTimeLayout 返回访问日志（text/json 格式）的时间格式：预设名称或 Go 时间布局，默认 RFC3339
+func (c Config) logTimeLayout() string {
+	if c.LogTimeFormat == "" {
+		return time.RFC3339
+	}
+	if layout, ok := logTimeLayouts[strings.ToLower(c.LogTimeFormat)]; ok {
+		return layout
+	}
+	return c.LogTimeFormat
+}
+
+// combinedQuote 按 combined 格式给字段加引号，空值记为 "-"，转义引号和反斜杠以免破坏分析工具的解析
+func combinedQuote(s string) string {
+	if s == "" {
+		return `"-"`
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// requestTooLargeBody 请求体超出 MaxRequestBytes 时返回的内容
+const requestTooLargeBody = `{"error": "request entity too large", "message": "The request body exceeds the allowed size"}`
+
+// isWebSocketUpgrade 判断请求是否为 WebSocket 握手（Connection: Upgrade 且 Upgrade: websocket）
+func isWebSocketUpgrade(r *http.Request) bool {
+	for _, v := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+			}
+		}
+	}
+	return false
+}
+
+// matchRequest 检查请求头和路径是否允许转发，authOK 为 true（已通过 JWT 或 Basic Auth）时不再检查请求头标识
+// 配置了 Routes 时按顺序匹配路由并返回对应目标；否则使用 CfHeader/RpPath 规则，目标由负载均衡器选择（返回 nil）
+// WebSocket 握手额外允许 WebSocketPaths，升级后由 ReverseProxy 劫持连接双向转发
+func matchRequest(cfg Config, r *http.Request, cfHeader string, authOK bool) (*backend, bool) {
+	if len(cfg.Routes) > 0 {
+		b := activeRouter.Load().match(cfg, r, cfHeader, authOK)
+		return b, b != nil
+	}
+
+	// 虚拟主机先按主机名选定目标，路径和请求头标识的检查不变
+	var b *backend
+	if len(cfg.Hosts) > 0 {
+		if b = activeHosts.Load().match(r.Host); b == nil {
+			return nil, false
+		}
+	}
+
+	pathOK := cfg.pathAllowed(r.URL.Path)
+	if isWebSocketUpgrade(r) {
+		pathOK = cfg.webSocketPathAllowed(r.URL.Path)
+	}
+	return b, (authOK || cfg.cfHeaderAllowed(cfHeader)) && pathOK
+}
+
+// rejectReason 说明请求未通过 matchRequest 的原因，只在 VerboseRejections 时使用
+func rejectReason(cfg Config, r *http.Request, cfHeader string, authOK bool) string {
+	if len(cfg.Routes) > 0 {
+		// 路径命中了路由但请求头标识不匹配该路由
+		for _, route := range cfg.Routes {
+			if cfg.matchPath([]string{route.Path}, r.URL.Path) {
+				return "header mismatch"
+			}
+		}
+		return "no route matches path"
+	}
+	if len(cfg.Hosts) > 0 && activeHosts.Load().match(r.Host) == nil {
+		return "unknown host"
+	}
+
+	pathOK := cfg.pathAllowed(r.URL.Path)
+	if isWebSocketUpgrade(r) {
+		pathOK = cfg.webSocketPathAllowed(r.URL.Path)
+	}
+	headerOK := authOK || cfg.cfHeaderAllowed(cfHeader)
+	switch {
+	case !pathOK && !headerOK:
+		return "path not allowed and header mismatch"
+	case !pathOK:
+		return "path not allowed"
+	default:
+		return "header mismatch"
+	}
+}
+
+// writeJSON 以 JSON 格式返回指定状态码的响应
+func writeJSON(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write([]byte(body))
+}
+
+// rewriteRequestHeaders 按配置移除和添加转发到上游的请求头，先移除后添加
+func rewriteRequestHeaders(req *http.Request, cfg Config) {
+	for _, k := range cfg.RemoveRequestHeaders {
+		req.Header.Del(k)
+	}
+	for k, v := range cfg.AddRequestHeaders {
+		req.Header.Set(k, v)
+	}
 }
 
-// setupProxy 创建并返回一个反向代理
+// setupProxy 创建并返回一个反向代理，多个目标时按轮询分发
 func setupProxy() *httputil.ReverseProxy {
-	target, err := url.Parse(loadConfig().RpAddr)
+	proxy, err := newProxy()
 	if err != nil {
-		log.Fatal("Failed to parse target URL:", err)
+		fatal(err)
 	}
+	return proxy
+}
+
+// newProxy 根据当前配置初始化负载均衡器、路由等运行时状态并创建反向代理
+func newProxy() (*httputil.ReverseProxy, error) {
+	lb, err := newBalancer(loadConfig().targets())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse target URL: %w", err)
+	}
+	rt, err := newRouter(loadConfig().Routes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse route target URL: %w", err)
+	}
+
+	hb, err := newHostBackends(loadConfig().Hosts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse host target URL: %w", err)
+	}
+	cb, err := newCanaryBackend(loadConfig().CanaryTarget)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse canary target URL: %w", err)
+	}
+
+	activeBalancer.Store(lb)
+	activeRouter.Store(rt)
+	activeHosts.Store(hb)
+	activeCanary.Store(cb)
+
+	transport, err := newTransport(loadConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load upstream CA: %w", err)
+	}
+
+	return &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			cfg := loadConfig()
+			setForwardedHeaders(req, cfg)
+
+			// 路由已选定目标时直接使用，否则由负载均衡器选择
+			// 路径改写在拼接目标路径之前进行
+			if b := selectedBackend(req); b != nil {
+				// 虚拟主机的目标没有固定路径，按 RpPaths 中匹配的路径改写
+				path := b.path
+				if path == "" {
+					path = cfg.matchedPath(req)
+				}
+				rewritePath(req, cfg, path)
+				b.director(req)
+			} else {
+				rewritePath(req, cfg, cfg.matchedPath(req))
+				b := pinnedBackend(req)
+				if b == nil {
+					b = activeBalancer.Load().next()
+				}
+				b.director(req)
+			}
+			// 标准库的 Director 不改 Host，默认改为目标主机，上游按虚拟主机路由时可保留原始 Host
+			if !cfg.PreserveHost {
+				req.Host = upstreamHost(req.URL)
+			}
+			rewriteRequestHeaders(req, cfg)
+			injectTraceContext(req)
+			if cfg.DebugBodyLog {
+				captureRequestBody(req, cfg)
+			}
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			cfg := loadConfig()
+			if len(cfg.CORS.AllowedOrigins) > 0 {
+				stripUpstreamCORS(resp.Header)
+			}
+			stripUpstreamSecurityHeaders(resp.Header, cfg.SecurityHeaders)
+			for k, v := range cfg.AddResponseHeaders {
+				resp.Header.Set(k, v)
+			}
+			// 配置了错误模板时替换上游的 4xx/5xx 响应，不再做内容改写
+			if tmpl, ok := cfg.errorResponse(resp.StatusCode); ok {
+				replaceErrorResponse(resp, tmpl)
+			} else if len(cfg.ResponseRewrite) > 0 {
+				if err := rewriteResponse(resp, cfg.ResponseRewrite); err != nil {
+					return err
+				}
+			}
+			if cfg.DebugBodyLog {
+				logBodies(resp, cfg)
+			}
+			return nil
+		},
+		// 标准库对 text/event-stream 和长度未知的响应会忽略该值立即刷新，SSE 事件不会被缓冲
+		FlushInterval: time.Duration(loadConfig().FlushInterval),
+		Transport:     &redirectTransport{next: &backupTransport{next: &breakerTransport{next: &timeoutTransport{next: &retryTransport{next: transport}}}}},
+		// 配置了 ErrorResponses 时各类错误使用对应的模板
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			cfg := loadConfig()
+			// 转发过程中读取请求体超出 MaxRequestBytes
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeProxyError(w, r, cfg, http.StatusRequestEntityTooLarge, requestTooLargeBody)
+				return
+			}
+			if errors.Is(err, errCircuitOpen) {
+				writeProxyError(w, r, cfg, http.StatusServiceUnavailable, serviceUnavailableBody)
+				return
+			}
+
+			if errors.Is(err, errUpstreamTimeout) {
+				upstreamErrorsTotal.Inc()
+				log.Printf("Upstream timeout for %s", r.RequestURI)
+				writeProxyError(w, r, cfg, http.StatusGatewayTimeout, gatewayTimeoutBody)
+				return
+			}
 
-	return httputil.NewSingleHostReverseProxy(target)
+			// 重试耗尽后仍失败，记录原因并返回与 404 一致的 JSON 格式，具体错误不暴露给客户端
+			upstreamErrorsTotal.Inc()
+			log.Printf("Upstream error for %s: %v", r.RequestURI, err)
+			writeProxyError(w, r, cfg, http.StatusBadGateway, cfg.badGatewayBody)
+		},
+	}, nil
 }
 
 // setupServer 创建并返回一个 HTTP 服务器
 func setupServer(proxy *httputil.ReverseProxy) *http.Server {
+	cfg := loadConfig()
+
+	// 配置了 ACMEDomains 时使用 Let's Encrypt 自动证书，否则从文件加载；监听 Unix 套接字时不使用 TLS
+	var getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	_, unixSocket := cfg.unixSocketPath()
+	if len(cfg.ACMEDomains) > 0 {
+		acmeManager = newACMEManager(cfg)
+		getCertificate = acmeManager.GetCertificate
+	} else if !unixSocket {
+		certs, err := newCertCache(cfg.CertFile, cfg.KeyFile, cfg.certCheckInterval())
+		if err != nil {
+			fatal("Failed to load certificate:", err)
+		}
+		getCertificate = certs.getCertificate
+	}
+
+	minVersion, err := parseTLSVersion(cfg.TLSMinVersion, tls.VersionTLS12)
+	if err != nil {
+		fatal("Invalid TLSMinVersion:", err)
+	}
+	maxVersion, err := parseTLSVersion(cfg.TLSMaxVersion, 0)
+	if err != nil {
+		fatal("Invalid TLSMaxVersion:", err)
+	}
+	cipherSuites, err := parseCipherSuites(cfg.CipherSuites)
+	if err != nil {
+		fatal("Invalid CipherSuites:", err)
+	}
+
+	clientCAs, clientAuth, err := loadClientAuth(cfg)
+	if err != nil {
+		fatal("Failed to load client CA:", err)
+	}
+
+	handler, err := newHandler(proxy)
+	if err != nil {
+		fatal(err)
+	}
+
 	return &http.Server{
-		Addr: ":443", // 监听 443 端口
-		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// 解析客户端 IP 和端口
-			ip, port := remoteaddr.Parse().IP(r)
-			cf_header := r.Header.Get("x-flag")
-
-			// 记录日志
-			logFormat(r.RemoteAddr, r.RequestURI, r.UserAgent(), ip+":"+port, cf_header)
-
-			// 检查请求头和路径是否符合条件
-			if cf_header == loadConfig().CfHeader && r.URL.Path == loadConfig().RpPath {
-				proxy.ServeHTTP(w, r)
-			} else {
-				// 返回 404 错误
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusNotFound)
-				w.Write([]byte(`{"error": "not found", "message": "The requested resource is not available"}`))
-			}
-		}),
+		Addr:    cfg.listenAddr(), // 默认监听 443 端口
+		Handler: handler,
 		TLSConfig: &tls.Config{
-			MinVersion:               tls.VersionTLS12,                         // 最低 TLS 版本
+			MinVersion:               minVersion,                               // 最低 TLS 版本
+			MaxVersion:               maxVersion,                               // 最高 TLS 版本，0 表示不限制
+			CipherSuites:             cipherSuites,                             // 允许的加密套件
 			CurvePreferences:         []tls.CurveID{tls.CurveP256, tls.X25519}, // 优先使用的曲线
 			PreferServerCipherSuites: true,                                     // 优先使用服务器的加密套件
-			NextProtos:               []string{"h2", "http/1.1"},               // 支持 HTTP/2
+			NextProtos:               cfg.nextProtos(),                         // 支持 HTTP/2，DisableHTTP2 时只用 HTTP/1.1
+			GetCertificate:           getCertificate,                           // 证书文件更新后自动加载，或由 ACME 签发
+			ClientCAs:                clientCAs,                                // 校验客户端证书的 CA
+			ClientAuth:               clientAuth,                               // 客户端证书校验方式
 		},
-		ReadTimeout:  5 * time.Second,   // 读取超时
-		WriteTimeout: 10 * time.Second,  // 写入超时
-		IdleTimeout:  120 * time.Second, // 空闲连接超时
+		ReadTimeout:       cfg.ReadTimeout.or(defaultReadTimeout),   // 读取超时
+		ReadHeaderTimeout: time.Duration(cfg.ReadHeaderTimeout),     // 读取请求头超时，0 时使用 ReadTimeout
+		WriteTimeout:      cfg.WriteTimeout.or(defaultWriteTimeout), // 写入超时
+		IdleTimeout:       cfg.IdleTimeout.or(defaultIdleTimeout),   // 空闲连接超时
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,                       // 请求头大小上限，超过时由 http.Server 返回 431，0 使用默认的 1MB
+		TLSNextProto:      cfg.tlsNextProto(),                       // DisableHTTP2 时彻底关闭 HTTP/2
+	}
+}
+
+// NewHandler 使用给定配置创建代理的处理器（不含 TLS 监听和健康检查等后台任务），可直接交给 httptest.NewServer 做集成测试
+// 配置和负载均衡器等运行时状态是进程内全局的，同一时间只有最后创建的处理器的配置生效
+func NewHandler(cfg Config) (http.Handler, error) {
+	if err := cfg.resolve(); err != nil {
+		return nil, err
+	}
+	configMu.Lock()
+	config = cfg
+	configMu.Unlock()
+
+	proxy, err := newProxy()
+	if err != nil {
+		return nil, err
+	}
+	return newHandler(proxy)
+}
+
+// newHandler 创建主处理函数：访问控制、认证、限流、日志等逻辑都在这里，之后交给 proxy 转发
+// 同时初始化处理函数用到的访问控制列表、JWT 校验器等运行时状态
+func newHandler(proxy *httputil.ReverseProxy) (http.Handler, error) {
+	cfg := loadConfig()
+
+	acl, err := newIPACL(cfg.AllowCIDRs, cfg.DenyCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse access control list: %w", err)
+	}
+	activeACL.Store(acl)
+
+	geoDB, err := openGeoDB(cfg.GeoDBPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database: %w", err)
+	}
+	activeGeo.Store(newGeoFilter(geoDB, cfg.AllowedCountries, cfg.BlockedCountries))
+
+	jv, err := newJWTVerifier(cfg.JWTAuth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load JWT key: %w", err)
+	}
+	activeJWT.Store(jv)
+	activeSemaphore.Store(newSemaphore(cfg.MaxConcurrentRequests))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received := time.Now()
+		cfg := loadConfig()
+
+		// 健康检查直接返回，不记录日志，避免负载均衡探测刷屏
+		if cfg.HealthPath != "" && r.URL.Path == cfg.HealthPath {
+			if draining.Load() {
+				writeJSON(w, http.StatusServiceUnavailable, `{"status":"draining"}`)
+				return
+			}
+			writeJSON(w, http.StatusOK, `{"status":"ok"}`)
+			return
+		}
+		if cfg.LivenessPath != "" && r.URL.Path == cfg.LivenessPath {
+			writeJSON(w, http.StatusOK, `{"status":"ok"}`)
+			return
+		}
+		if cfg.ReadinessPath != "" && r.URL.Path == cfg.ReadinessPath {
+			switch {
+			case draining.Load():
+				writeJSON(w, http.StatusServiceUnavailable, `{"status":"draining"}`)
+			case cfg.HealthCheckPath != "" && !upstreamReady(cfg):
+				writeJSON(w, http.StatusServiceUnavailable, `{"status":"upstream not ready"}`)
+			default:
+				writeJSON(w, http.StatusOK, `{"status":"ready"}`)
+			}
+			return
+		}
+		if cfg.MetricsPath != "" && r.URL.Path == cfg.MetricsPath {
+			metricsHandler.ServeHTTP(w, r)
+			return
+		}
+		requestsTotal.Inc()
+
+		// 解析客户端 IP 和端口
+		ip, port := cfg.clientIP(r)
+		clientAddr := ip
+		if port != "" {
+			clientAddr = ip + ":" + port
+		}
+		cf_header := r.Header.Get(cfg.cfHeaderName())
+
+		// 生成或沿用请求 ID，转发给上游并返回给客户端
+		reqID := requestID(r.Header.Get(requestIDHeader))
+		r.Header.Set(requestIDHeader, reqID)
+		w.Header().Set(requestIDHeader, reqID)
+		setSecurityHeaders(w.Header(), cfg.SecurityHeaders)
+
+		// 响应结束后记录日志，带上返回给客户端的状态码和字节数
+		rec := &statusRecorder{ResponseWriter: w}
+		w = rec
+		entry := accessEntry{
+			URI:        r.RequestURI,
+			UserAgent:  r.UserAgent(),
+			ClientIP:   clientAddr,
+			CfHeader:   cf_header,
+			RemoteAddr: r.RemoteAddr,
+			ClientCN:   clientCertCN(r),
+			RequestID:  reqID,
+			IP:         ip,
+			Method:     r.Method,
+			Proto:      r.Proto,
+			Referer:    r.Referer(),
+		}
+		for _, name := range cfg.LogHeaders {
+			v := r.Header.Get(name)
+			if v == "" {
+				v = "-"
+			}
+			if entry.Headers == nil {
+				entry.Headers = make(map[string]string, len(cfg.LogHeaders))
+			}
+			entry.Headers[name] = v
+			entry.headerValues = append(entry.headerValues, v)
+		}
+		if cfg.HTTPListenAddr != "" {
+			entry.Listener = listenerName(r)
+		}
+		if cfg.LogTLS && r.TLS != nil {
+			entry.TLSVersion = tlsVersionName(r.TLS.Version)
+			entry.CipherSuite = tls.CipherSuiteName(r.TLS.CipherSuite)
+			entry.ServerName = r.TLS.ServerName
+		}
+		defer func() {
+			entry.Status = rec.statusCode()
+			entry.Bytes = rec.bytes
+			entry.Cache = rec.Header().Get(cacheStatusHeader)
+			entry.DurationMs = float64(time.Since(received).Microseconds()) / 1000
+			if cfg.sampleAccessLog(entry.Status) {
+				logFormat(entry)
+			}
+		}()
+		// 在记录日志之前执行，panic 时访问日志记为 500
+		defer recoverPanic(rec, r)
+
+		// 按客户端 IP 做访问控制
+		if !activeACL.Load().permits(ip) {
+			writeJSON(w, http.StatusForbidden, `{"error": "forbidden", "message": "Access denied"}`)
+			return
+		}
+
+		// 按客户端 IP 所在国家做访问控制
+		if !activeGeo.Load().permits(ip) {
+			writeJSON(w, http.StatusForbidden, `{"error": "forbidden", "message": "Access denied"}`)
+			return
+		}
+
+		// 限制单个客户端 IP 同时处理的请求数，防止大量并发连接耗尽资源
+		if cfg.MaxConnsPerIP > 0 {
+			if !clientConns.acquire(ip, cfg.MaxConnsPerIP) {
+				writeJSON(w, http.StatusTooManyRequests, tooManyConnsBody)
+				return
+			}
+			defer clientConns.release(ip)
+		}
+
+		// 按客户端 IP 限流，路由可单独设置更严格或更宽松的限额
+		if ok, wait := allowRequest(cfg, r.URL.Path, ip); !ok {
+			w.Header().Set("Retry-After", retryAfterSeconds(wait))
+			writeJSON(w, http.StatusTooManyRequests, `{"error": "too many requests", "message": "Rate limit exceeded, please retry later"}`)
+			return
+		}
+
+		// 性能分析接口只对管理令牌开放
+		if cfg.EnablePprof && strings.HasPrefix(r.URL.Path, pprofPrefix) {
+			if !cfg.adminAuthorized(r) {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeJSON(w, http.StatusUnauthorized, unauthorizedBody)
+				return
+			}
+			pprofHandler.ServeHTTP(w, r)
+			return
+		}
+
+		// 通过管理接口重载配置
+		if cfg.AdminReloadPath != "" && r.URL.Path == cfg.AdminReloadPath {
+			if !cfg.adminAuthorized(r) {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeJSON(w, http.StatusUnauthorized, unauthorizedBody)
+				return
+			}
+			serveReload(w, r, ip)
+			return
+		}
+
+		// 通过管理接口查看当前生效的配置
+		if cfg.AdminConfigPath != "" && r.URL.Path == cfg.AdminConfigPath {
+			if !cfg.adminAuthorized(r) {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeJSON(w, http.StatusUnauthorized, unauthorizedBody)
+				return
+			}
+			serveConfig(w, r, cfg)
+			return
+		}
+
+		// 通过管理接口进入或退出下线状态
+		if cfg.AdminDrainPath != "" && r.URL.Path == cfg.AdminDrainPath {
+			if !cfg.adminAuthorized(r) {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeJSON(w, http.StatusUnauthorized, unauthorizedBody)
+				return
+			}
+			serveDrain(w, r, ip)
+			return
+		}
+
+		// 允许的跨域来源：所有响应（包括错误）都带上 CORS 头，预检请求直接应答，预检不带认证信息所以放在认证之前
+		if origin := r.Header.Get("Origin"); origin != "" && cfg.CORS.originAllowed(origin) {
+			setCORSHeaders(w.Header(), cfg.CORS, origin)
+			if isPreflight(r) {
+				writePreflight(w, r, cfg.CORS)
+				return
+			}
+		}
+
+		// 启用 JWT 时必须带有效令牌，否则请求头标识和 Basic Auth 任一通过即可
+		jv := activeJWT.Load()
+		if jv != nil {
+			if err := jv.verify(r); err != nil {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeJSON(w, http.StatusUnauthorized, unauthorizedBody)
+				return
+			}
+		}
+
+		// 检查请求头和路径是否符合条件
+		basicAuthOK := jv == nil && cfg.basicAuthAllowed(r)
+		if b, ok := matchRequest(cfg, r, cf_header, jv != nil || basicAuthOK); ok {
+			if b != nil {
+				r = withBackend(r, b)
+			} else if cv := activeCanary.Load(); cv != nil {
+				// 客户端主动选择或按比例分流到金丝雀目标，访问日志记录实际使用的版本便于对比
+				entry.Variant = variantStable
+				if cfg.canaryRequested(r) {
+					r = withBackend(r, cv)
+					entry.Variant = variantCanary
+				}
+			}
+			// Basic Auth 凭据只用于本服务，不转发给上游
+			if basicAuthOK {
+				r.Header.Del("Authorization")
+			}
+
+			// 维护模式下不转发
+			if cfg.MaintenanceMode {
+				serveMaintenance(w, cfg, reqID)
+				return
+			}
+
+			// 只转发允许的请求方法
+			if !cfg.methodAllowed(r.Method) {
+				w.Header().Set("Allow", strings.Join(cfg.AllowedMethods, ", "))
+				writeJSON(w, http.StatusMethodNotAllowed, `{"error": "method not allowed", "message": "The request method is not supported"}`)
+				return
+			}
+
+			// 限制请求体大小，声明的长度已超限时直接拒绝，否则在读取时截断
+			if limit := cfg.MaxRequestBytes; limit > 0 {
+				if r.ContentLength > limit {
+					writeJSON(w, http.StatusRequestEntityTooLarge, requestTooLargeBody)
+					return
+				}
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+			}
+
+			// 会话保持：同一客户端固定转发到同一目标（路由规则自带目标，不参与）
+			if cfg.Stickiness != "" && selectedBackend(r) == nil {
+				r = pinBackend(cfg, w, r, ip)
+			}
+
+			// 限制同时转发的请求数，保护上游不被压垮
+			if sem := activeSemaphore.Load(); sem != nil {
+				if !sem.acquire(r.Context(), time.Duration(cfg.ConcurrencyQueueTimeout)) {
+					w.Header().Set("Retry-After", "1")
+					writeJSON(w, http.StatusServiceUnavailable, withRequestID(overloadedBody, reqID))
+					return
+				}
+				defer sem.release()
+			}
+			inFlightRequests.Inc()
+			defer inFlightRequests.Dec()
+
+			proxiedTotal.Inc()
+			r, span := startSpan(r)
+			defer func() { endSpan(span, rec.statusCode()) }()
+			start := time.Now()
+			// HandlerTimeout 放在访问日志之内，超时的 503 会如实记录
+			withHandlerTimeout(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				compressHandler(cfg.Compression, w, r, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					cacheHandler(cfg, w, r, proxy)
+				}))
+			})).ServeHTTP(w, r)
+			proxyLatency.Observe(time.Since(start).Seconds())
+		} else {
+			// 返回 404 错误（状态码和内容可配置）
+			rejectedTotal.Inc()
+			body := withRequestID(cfg.notFoundBody, reqID)
+			// 调试时记录并返回具体的拒绝原因，生产环境保持统一的 404，避免帮助攻击者探测
+			if cfg.VerboseRejections {
+				entry.Reason = rejectReason(cfg, r, cf_header, jv != nil || basicAuthOK)
+				body = withJSONField(body, "reason", entry.Reason)
+			}
+			writeJSON(w, cfg.notFoundStatus(), body)
+		}
+	}), nil
+}
+
+// setupRedirectServer 创建将 HTTP 请求 301 跳转到 HTTPS 的服务器
+// ACME 模式下同时负责响应 HTTP-01 验证请求
+func setupRedirectServer(addr string) *http.Server {
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 使用原始 Host 头，去掉 HTTP 端口后跳转到默认 443 端口
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+	if acmeManager != nil {
+		handler = acmeManager.HTTPHandler(handler)
+	}
+
+	return &http.Server{
+		Addr:         addr,
+		Handler:      handler,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  120 * time.Second,
 	}
 }
 
 // main 函数是程序入口
 func main() {
+	// 主 goroutine panic 退出前写出缓冲的访问日志
+	defer func() {
+		if p := recover(); p != nil {
+			flushAccessLog()
+			panic(p)
+		}
+	}()
+	setup()
+
+	shutdownTracing, err := setupTracing(loadConfig())
+	if err != nil {
+		fatal("Failed to set up tracing:", err)
+	}
+
+	if loadConfig().DebugBodyLog {
+		log.Println("Warning: DebugBodyLog is enabled, request and response bodies will be logged")
+	}
+	if loadConfig().UpstreamInsecureSkipVerify {
+		log.Println("Warning: UpstreamInsecureSkipVerify is enabled, upstream certificates are not verified")
+	}
 
 	proxy := setupProxy()        // 初始化反向代理
 	server := setupServer(proxy) // 初始化 HTTP 服务器
 
-	// 启动服务器使用https模式
-	log.Println("Starting server tls on :443")
-	if err := server.ListenAndServeTLS(loadConfig().CertFile, loadConfig().KeyFile); err != nil {
-		log.Fatal("Server TLS error:", err)
+	// 明文 HTTP 监听与 TLS 服务共用处理器，代理、认证和访问控制完全相同
+	var plain *http.Server
+	if addr := loadConfig().HTTPListenAddr; addr != "" {
+		plain = setupPlainServer(server, addr)
+	}
+
+	// 启动前检查上游是否可达，尽早发现配置错误
+	if cfg := loadConfig(); cfg.CheckUpstreamOnStart || cfg.FailFastOnUpstream {
+		if err := checkUpstreams(cfg); err != nil && cfg.FailFastOnUpstream {
+			fatal("Upstream check failed:", err)
+		}
+	}
+
+	// HTTP/3 与 TLS 服务器共用处理器和证书，其余协议的响应通过 Alt-Svc 告知客户端
+	var h3 *http3.Server
+	if loadConfig().EnableHTTP3 {
+		h3 = setupHTTP3Server(server)
+		server.Handler = altSvcHandler(h3, server.Handler)
+		go func() {
+			log.Println("Starting server http3 on udp", server.Addr)
+			if err := h3.ListenAndServe(); err != http.ErrServerClosed {
+				fatal("Server HTTP/3 error:", err)
+			}
+		}()
+	}
+
+	// ACME 的 HTTP-01 验证必须在 80 端口完成，未配置跳转监听时默认开启；明文 HTTP 监听 80 端口时由它处理验证
+	addr := loadConfig().HTTPRedirectAddr
+	if addr == "" && acmeManager != nil && !plainServesPort80(loadConfig().HTTPListenAddr) {
+		addr = ":80"
+	}
+
+	servers := []*http.Server{server}
+	if plain != nil {
+		servers = append(servers, plain)
+		go func() {
+			log.Println("Starting server http on", plain.Addr)
+			if err := serveTCP(plain, false, false); err != http.ErrServerClosed {
+				fatal("Server HTTP error:", err)
+			}
+		}()
+	}
+	if addr != "" {
+		redirect := setupRedirectServer(addr)
+		servers = append(servers, redirect)
+		go func() {
+			log.Println("Starting http redirect server on", addr)
+			if err := serveTCP(redirect, false, false); err != http.ErrServerClosed {
+				fatal("Redirect server error:", err)
+			}
+		}()
+	}
+
+	go watchReload()     // 收到 SIGHUP 时热加载配置
+	go watchLogReopen()  // 收到 SIGUSR1 时重新打开日志文件
+	go runLogFlusher()   // 定期写出缓冲的访问日志
+	go runHealthChecks() // 主动探测上游，跳过不可用的目标
+	if loadConfig().WatchConfig {
+		go watchConfigFile() // 配置文件修改后自动热加载
+	}
+
+	// 收到 SIGINT/SIGTERM 后停止接收新连接，等待进行中的请求完成
+	stopped := make(chan struct{})
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		log.Printf("Received signal %v, shutting down", <-sig)
+
+		ctx, cancel := context.WithTimeout(context.Background(), loadConfig().shutdownTimeout())
+		defer cancel()
+		// Shutdown 不会等待也不会关闭已被接管的 WebSocket 连接，与普通请求同时单独等待
+		wsDone := make(chan struct{})
+		go func() {
+			drainWebSockets(loadConfig().webSocketDrainTimeout())
+			close(wsDone)
+		}()
+		for _, srv := range servers {
+			if err := srv.Shutdown(ctx); err != nil {
+				log.Println("Server shutdown error:", err)
+			}
+		}
+		<-wsDone
+		if h3 != nil {
+			if err := h3.Shutdown(ctx); err != nil {
+				log.Println("Server HTTP/3 shutdown error:", err)
+			}
+		}
+		if shutdownTracing != nil {
+			if err := shutdownTracing(ctx); err != nil {
+				log.Println("Tracing shutdown error:", err)
+			}
+		}
+		close(stopped)
+	}()
+
+	// unix: 地址监听 Unix 套接字，只用于本机的前置代理（如 nginx），不使用 TLS
+	if path, ok := loadConfig().unixSocketPath(); ok {
+		ln, err := listenUnix(path)
+		if err != nil {
+			fatal("Failed to listen on unix socket:", err)
+		}
+		log.Println("Starting server on unix socket", path)
+		if err := server.Serve(ln); err != http.ErrServerClosed {
+			fatal("Server error:", err)
+		}
+	} else {
+		// 启动服务器使用https模式
+		log.Println("Starting server tls on", server.Addr)
+		// 证书由 TLSConfig.GetCertificate 提供，这里无需再传入文件路径
+		if err := serveTCP(server, true, loadConfig().EnableProxyProtocol); err != http.ErrServerClosed {
+			fatal("Server TLS error:", err)
+		}
+	}
+
+	<-stopped
+	log.Println("Server stopped")
+	configMu.Lock()
+	flushAccessLog()
+	logFile.Close() // 关闭前将日志刷到磁盘
+	if accessLogFile != nil {
+		accessLogFile.Close()
 	}
+	configMu.Unlock()
 }
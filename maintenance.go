@@ -0,0 +1,24 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultMaintenanceRetryAfter 未配置 MaintenanceRetryAfter 时 Retry-After 的秒数
+const defaultMaintenanceRetryAfter = 5 * time.Minute
+
+// serveMaintenance 维护模式下返回 503 和维护页面，未配置 MaintenanceFile 时返回 JSON
+func serveMaintenance(w http.ResponseWriter, cfg Config, reqID string) {
+	retryAfter := cfg.MaintenanceRetryAfter.or(defaultMaintenanceRetryAfter)
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+	if cfg.maintenancePage == nil {
+		writeJSON(w, http.StatusServiceUnavailable, withRequestID(serviceUnavailableBody, reqID))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write(cfg.maintenancePage)
+}
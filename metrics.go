@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus 指标，通过 MetricsPath 暴露
+var (
+	requestsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "goweb_requests_total",
+		Help: "Total number of requests received.",
+	})
+	rejectedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "goweb_rejected_requests_total",
+		Help: "Requests rejected by the header/path check.",
+	})
+	proxiedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "goweb_proxied_requests_total",
+		Help: "Requests forwarded to the upstream.",
+	})
+	upstreamErrorsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "goweb_upstream_errors_total",
+		Help: "Proxied requests that failed with an upstream error.",
+	})
+	inFlightRequests = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "goweb_in_flight_requests",
+		Help: "Proxied requests currently being processed.",
+	})
+	proxyLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "goweb_proxy_latency_seconds",
+		Help:    "Latency of proxied requests in seconds.",
+		Buckets: prometheus.DefBuckets,
+	})
+)
+
+// metricsHandler 输出 Prometheus 格式的指标
+var metricsHandler = promhttp.Handler()
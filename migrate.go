@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+)
+
+// currentConfigVersion 当前配置文件格式版本
+// 字段发生不兼容变更（改名、含义变化）时递增，并在 migrateConfig 中补上旧版本的迁移
+const currentConfigVersion = 1
+
+// migrateConfig 检查配置文件的版本并做必要的迁移，data 为配置文件的原始内容
+// 未识别的键在 StrictConfig 下直接报错，否则记录警告，避免拼写错误的配置项被悄悄忽略
+func migrateConfig(c *Config, data []byte) error {
+	if c.strictConfig() {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(new(Config)); err != nil {
+			return fmt.Errorf("invalid config file (set StrictConfig to false to ignore unknown keys): %w", err)
+		}
+	} else {
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return fmt.Errorf("解析 JSON 失败: %w", err)
+		}
+		for key := range raw {
+			if !knownConfigKey(key) {
+				log.Printf("Warning: unknown config key %q ignored", key)
+			}
+		}
+	}
+
+	switch {
+	case c.Version > currentConfigVersion:
+		return fmt.Errorf("config version %d is newer than supported version %d", c.Version, currentConfigVersion)
+	case c.Version == 0:
+		// 未声明版本的配置文件与版本 1 格式相同
+		c.Version = currentConfigVersion
+	}
+	return nil
+}
+
+// knownConfigKey 判断键名是否对应 Config 中的字段，与 encoding/json 一样不区分大小写
+func knownConfigKey(key string) bool {
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" && strings.EqualFold(name, key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// internalErrorBody 处理请求时发生 panic 返回的内容
+const internalErrorBody = `{"error": "internal server error", "message": "An unexpected error occurred"}`
+
+// recoverPanic 在处理函数中 defer 调用，捕获 panic 并记录堆栈，尚未写出响应时返回 500
+// http.ErrAbortHandler 是 ReverseProxy 在客户端断开时主动中止的信号，继续抛出交给 http.Server 静默处理
+func recoverPanic(w *statusRecorder, r *http.Request) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	if p == http.ErrAbortHandler {
+		panic(p)
+	}
+	log.Printf("Panic serving %s %s (request %s): %v\n%s", r.Method, r.RequestURI, r.Header.Get(requestIDHeader), p, debug.Stack())
+	// 写出已缓冲的访问日志，若进程随后崩溃也不会丢失之前的记录
+	flushAccessLog()
+	if w.status == 0 {
+		writeJSON(w, http.StatusInternalServerError, withRequestID(internalErrorBody, r.Header.Get(requestIDHeader)))
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestProxy 用给定配置创建代理并启动测试服务器，CfHeader 默认为 "secret"
+func newTestProxy(t *testing.T, cfg Config) *httptest.Server {
+	t.Helper()
+	if cfg.CfHeader == "" {
+		cfg.CfHeader = "secret"
+	}
+	h, err := NewHandler(cfg)
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newEchoWebSocketServer 启动一个完成升级握手后原样回显收到数据的上游
+// 没有引入 WebSocket 库，握手手工完成，之后的字节不按帧解析
+func newEchoWebSocketServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Errorf("hijack: %v", err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		rw.Flush()
+		buf := make([]byte, 1024)
+		for {
+			n, err := rw.Read(buf)
+			if err != nil {
+				return
+			}
+			conn.Write(buf[:n])
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestWebSocketThroughProxy(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"plain", Config{}},
+		{"upstream timeout", Config{UpstreamTimeout: Duration(time.Second)}},
+		{"debug body log", Config{DebugBodyLog: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newEchoWebSocketServer(t)
+			cfg := tt.cfg
+			cfg.RpAddr = backend.URL
+			cfg.RpPath = "/ws"
+			proxy := newTestProxy(t, cfg)
+
+			conn, err := net.Dial("tcp", proxy.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			io.WriteString(conn, "GET /ws HTTP/1.1\r\n"+
+				"Host: example.com\r\n"+
+				"Upgrade: websocket\r\n"+
+				"Connection: Upgrade\r\n"+
+				"Sec-WebSocket-Version: 13\r\n"+
+				"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"+
+				"x-flag: secret\r\n\r\n")
+			br := bufio.NewReader(conn)
+			resp, err := http.ReadResponse(br, nil)
+			if err != nil {
+				t.Fatalf("read handshake response: %v", err)
+			}
+			if resp.StatusCode != http.StatusSwitchingProtocols {
+				t.Fatalf("status = %d, want 101", resp.StatusCode)
+			}
+
+			// 升级后的连接双向转发，多次往返都能收到回显
+			for _, msg := range []string{"ping", "hello websocket"} {
+				if _, err := io.WriteString(conn, msg); err != nil {
+					t.Fatalf("write: %v", err)
+				}
+				got := make([]byte, len(msg))
+				if _, err := io.ReadFull(br, got); err != nil {
+					t.Fatalf("read echo: %v", err)
+				}
+				if string(got) != msg {
+					t.Fatalf("echo = %q, want %q", got, msg)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// 限流器清理参数：超过 visitorIdleTTL 未出现的客户端会被移除
+const (
+	visitorCleanupInterval = time.Minute
+	visitorIdleTTL         = 3 * time.Minute
+)
+
+// visitor 记录单个客户端的令牌桶和最后访问时间
+type visitor struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// ipLimiter 按客户端 IP 维护令牌桶限流器
+type ipLimiter struct {
+	mu       sync.Mutex
+	visitors map[string]*visitor
+}
+
+// newIPLimiter 创建限流器并启动后台清理，避免 map 无限增长
+func newIPLimiter() *ipLimiter {
+	l := &ipLimiter{visitors: make(map[string]*visitor)}
+	go l.cleanup()
+	return l
+}
+
+// allow 判断该 IP 是否还有令牌，没有时同时返回需要等待的时长
+// rps/burst 变化（如配置重载）时同步更新已有的令牌桶
+func (l *ipLimiter) allow(ip string, rps float64, burst int) (bool, time.Duration) {
+	if burst < 1 {
+		burst = 1 // 容量为 0 的令牌桶会拒绝所有请求
+	}
+
+	l.mu.Lock()
+	v, ok := l.visitors[ip]
+	if !ok {
+		v = &visitor{limiter: rate.NewLimiter(rate.Limit(rps), burst)}
+		l.visitors[ip] = v
+	} else {
+		if v.limiter.Limit() != rate.Limit(rps) {
+			v.limiter.SetLimit(rate.Limit(rps))
+		}
+		if v.limiter.Burst() != burst {
+			v.limiter.SetBurst(burst)
+		}
+	}
+	v.lastSeen = time.Now()
+	l.mu.Unlock()
+
+	res := v.limiter.Reserve()
+	if delay := res.Delay(); delay > 0 {
+		res.Cancel() // 被拒绝的请求不占用令牌
+		return false, delay
+	}
+	return true, 0
+}
+
+// cleanup 定期移除长时间没有请求的客户端
+func (l *ipLimiter) cleanup() {
+	for range time.Tick(visitorCleanupInterval) {
+		l.mu.Lock()
+		for ip, v := range l.visitors {
+			if time.Since(v.lastSeen) > visitorIdleTTL {
+				delete(l.visitors, ip)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// clientLimiter 全局的客户端 IP 限流器
+var clientLimiter = newIPLimiter()
+
+// routeLimiters 按路由路径划分的客户端 IP 限流器，跨配置重载保留，避免重载后令牌桶被重置
+var (
+	routeLimitersMu sync.Mutex
+	routeLimiters   = make(map[string]*ipLimiter)
+)
+
+// routeLimiter 返回路由路径对应的限流器，首次使用时创建
+func routeLimiter(path string) *ipLimiter {
+	routeLimitersMu.Lock()
+	defer routeLimitersMu.Unlock()
+	l, ok := routeLimiters[path]
+	if !ok {
+		l = newIPLimiter()
+		routeLimiters[path] = l
+	}
+	return l
+}
+
+// allowRequest 按请求路径选择限流规则：第一条路径匹配且设置了 RateLimitRPS 的路由使用自己的限流器，
+// 否则使用全局的 RateLimitRPS/RateLimitBurst；都未设置时不限流
+func allowRequest(cfg Config, path, ip string) (bool, time.Duration) {
+	for _, route := range cfg.Routes {
+		if route.RateLimitRPS > 0 && cfg.matchPath([]string{route.Path}, path) {
+			return routeLimiter(route.Path).allow(ip, route.RateLimitRPS, route.RateLimitBurst)
+		}
+	}
+	if cfg.RateLimitRPS > 0 {
+		return clientLimiter.allow(ip, cfg.RateLimitRPS, cfg.RateLimitBurst)
+	}
+	return true, 0
+}
+
+// retryAfterSeconds 将等待时长换算为 Retry-After 的秒数，向上取整且至少为 1
+func retryAfterSeconds(d time.Duration) string {
+	secs := int(math.Ceil(d.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	return strconv.Itoa(secs)
+}
+
+// tooManyConnsBody 单个客户端 IP 同时处理的请求数超过 MaxConnsPerIP 时返回的内容
+const tooManyConnsBody = `{"error": "too many requests", "message": "Too many concurrent requests from this client"}`
+
+// ipConns 按客户端 IP 统计正在处理的请求数
+// 在处理函数中计数而不是包装 listener：TLS 握手前无法返回 429，HTTP/2 下一个连接也会承载多个请求
+type ipConns struct {
+	mu     sync.Mutex
+	active map[string]int
+}
+
+// clientConns 全局的客户端 IP 并发计数
+var clientConns = &ipConns{active: make(map[string]int)}
+
+// acquire 该 IP 正在处理的请求数未达到 limit 时计数加一并返回 true
+func (c *ipConns) acquire(ip string, limit int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.active[ip] >= limit {
+		return false
+	}
+	c.active[ip]++
+	return true
+}
+
+// release 请求结束后计数减一，归零时删除以免 map 无限增长
+func (c *ipConns) release(ip string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.active[ip]--; c.active[ip] <= 0 {
+		delete(c.active, ip)
+	}
+}
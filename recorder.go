@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// statusRecorder 包装 ResponseWriter，记录返回给客户端的状态码和响应体字节数，供访问日志使用
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	// 1xx 是中间响应，以最终状态码为准
+	if r.status == 0 && code >= 200 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Flush 实现 http.Flusher，保证流式响应（SSE、分块传输）能及时下发
+func (r *statusRecorder) Flush() {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	http.NewResponseController(r.ResponseWriter).Flush()
+}
+
+// Hijack 实现 http.Hijacker，WebSocket 握手成功后接管连接，此时状态码记为 101
+// 接管的连接记录在 hijackedConns 中，关闭服务时统一处理
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err != nil {
+		return conn, brw, err
+	}
+	if r.status == 0 {
+		r.status = http.StatusSwitchingProtocols
+	}
+	return hijackedConns.track(conn), brw, nil
+}
+
+// Unwrap 让 http.ResponseController 能拿到底层的 ResponseWriter
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// statusCode 返回记录到的状态码，处理函数没有写任何内容时按 200 计
+func (r *statusRecorder) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// defaultMaxBackendRedirects 未配置 MaxBackendRedirects 时最多跟随的上游转移次数
+const defaultMaxBackendRedirects = 3
+
+// errTooManyBackendRedirects 上游转移次数超过上限，可能是上游之间互相转移形成了循环
+var errTooManyBackendRedirects = errors.New("too many backend redirects")
+
+// maxBackendRedirects 返回最多跟随的上游转移次数
+func (c Config) maxBackendRedirects() int {
+	if c.MaxBackendRedirects <= 0 {
+		return defaultMaxBackendRedirects
+	}
+	return c.MaxBackendRedirects
+}
+
+// redirectTarget 解析上游返回的转移地址，只接受已配置的上游（按 scheme 和主机比较），避免被引导到任意地址
+func (c Config) redirectTarget(addr string) (*url.URL, bool) {
+	u, err := url.Parse(addr)
+	if err != nil || u.Host == "" {
+		return nil, false
+	}
+	for _, upstream := range c.upstreamAddrs() {
+		if known, err := url.Parse(upstream); err == nil && known.Scheme == u.Scheme && known.Host == u.Host {
+			return u, true
+		}
+	}
+	return nil, false
+}
+
+// redirectTransport 上游在响应中带有 BackendRedirectHeader 时，改为向其指定的上游重新发送请求
+// 只有没有请求体的请求会重新发送（请求体已被读取，无法重放）
+type redirectTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip 实现 http.RoundTripper，未配置 BackendRedirectHeader 时直接转发
+func (t *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	cfg := loadConfig()
+	header := cfg.BackendRedirectHeader
+	if err != nil || header == "" {
+		return resp, err
+	}
+
+	for hops := 0; ; hops++ {
+		addr := resp.Header.Get(header)
+		if addr == "" {
+			return resp, nil
+		}
+		resp.Header.Del(header)
+		target, ok := cfg.redirectTarget(addr)
+		if !ok {
+			log.Printf("Ignoring backend redirect for %s to unknown upstream %q", req.URL, addr)
+			return resp, nil
+		}
+		if req.Body != nil && req.Body != http.NoBody {
+			return resp, nil
+		}
+		if hops >= cfg.maxBackendRedirects() {
+			resp.Body.Close()
+			return nil, errTooManyBackendRedirects
+		}
+		resp.Body.Close()
+
+		out := req.Clone(req.Context())
+		out.URL.Scheme = target.Scheme
+		out.URL.Host = target.Host
+		if !cfg.PreserveHost {
+			out.Host = target.Host
+		}
+		if resp, err = t.next.RoundTrip(out); err != nil {
+			return nil, err
+		}
+		req = out
+	}
+}
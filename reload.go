@@ -0,0 +1,245 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchReload 监听 SIGHUP 信号，收到后重新加载配置文件
+func watchReload() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	for range sig {
+		log.Println("Received SIGHUP, reloading config")
+		if err := reloadConfig(); err != nil {
+			log.Println("Config reload failed, keeping current config:", err)
+		}
+	}
+}
+
+// configWatchDebounce 配置文件变化后等待的时间，编辑器保存时往往连续触发多次写入
+const configWatchDebounce = 500 * time.Millisecond
+
+// watchConfigFile 监听配置文件，写入或被替换后自动重载，新配置无效时保留旧配置（同 SIGHUP）
+// 监听所在目录而不是文件本身，编辑器通过重命名替换文件后也能继续收到事件；合并多个文件时监听每一个
+func watchConfigFile() {
+	paths := make(map[string]bool)
+	for _, p := range splitConfigPaths(configPath) {
+		if p == stdinConfigPath || isRemoteConfig(p) {
+			log.Println("WatchConfig only works with local config files, ignored")
+			return
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			log.Println("Failed to watch config file:", err)
+			return
+		}
+		paths[abs] = true
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Println("Failed to watch config file:", err)
+		return
+	}
+	defer watcher.Close()
+	for path := range paths {
+		if err := watcher.Add(filepath.Dir(path)); err != nil {
+			log.Println("Failed to watch config file:", err)
+			return
+		}
+	}
+
+	var timer *time.Timer
+	for {
+		select {
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if !paths[filepath.Clean(ev.Name)] || ev.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			if timer != nil {
+				timer.Reset(configWatchDebounce)
+				continue
+			}
+			timer = time.AfterFunc(configWatchDebounce, func() {
+				log.Println("Config file changed, reloading config")
+				if err := reloadConfig(); err != nil {
+					log.Println("Config reload failed, keeping current config:", err)
+				}
+			})
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Println("Config watcher error:", err)
+		}
+	}
+}
+
+// watchLogReopen 监听 SIGUSR1 信号，收到后重新打开日志文件，配合 logrotate 的 postrotate 使用
+func watchLogReopen() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR1)
+	for range sig {
+		configMu.RLock()
+		err := logFile.reopen()
+		if accessLogFile != nil && err == nil {
+			err = accessLogFile.reopen()
+		}
+		configMu.RUnlock()
+		if err != nil {
+			log.Println("Failed to reopen log file, keeping current file:", err)
+			continue
+		}
+		log.Println("Received SIGUSR1, log file reopened")
+	}
+}
+
+// reloadMu 串行化重载，SIGHUP 和管理接口可能同时触发
+var reloadMu sync.Mutex
+
+// reloadConfig 重新读取配置文件，应用可在运行时变更的配置项
+// 代理目标、路由、路径、请求头标识、访问控制和日志文件会立即生效，已建立的连接不受影响
+func reloadConfig() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	if readsStdin(configPath) {
+		return errors.New("config was read from stdin and cannot be reloaded")
+	}
+	newCfg, err := loadFile(configPath)
+	if err != nil {
+		return err
+	}
+	if err := validateConfig(newCfg); err != nil {
+		return err
+	}
+	lb, err := newBalancer(newCfg.targets())
+	if err != nil {
+		return err
+	}
+	rt, err := newRouter(newCfg.Routes)
+	if err != nil {
+		return err
+	}
+	hb, err := newHostBackends(newCfg.Hosts)
+	if err != nil {
+		return err
+	}
+	cb, err := newCanaryBackend(newCfg.CanaryTarget)
+	if err != nil {
+		return err
+	}
+	acl, err := newIPACL(newCfg.AllowCIDRs, newCfg.DenyCIDRs)
+	if err != nil {
+		return err
+	}
+	jv, err := newJWTVerifier(newCfg.JWTAuth)
+	if err != nil {
+		return err
+	}
+
+	old := loadConfig()
+	keepStaticFields(&newCfg, old)
+
+	// 路径变化，或启动时日志文件打开失败正在使用 stderr，都重新打开日志文件；输出到 stdout/syslog 时不涉及
+	var newLog *logWriter
+	if newCfg.logTarget() == logTargetFile && (newCfg.LogFile != old.LogFile || logFile.path == "") {
+		newLog, err = newLogWriter(newCfg.LogFile, newCfg.LogMaxSizeMB, newCfg.LogMaxBackups)
+		if err != nil && newCfg.LogFile != old.LogFile {
+			return err
+		}
+		// 路径未变且仍无法打开时继续使用 stderr
+	}
+
+	// 访问日志文件路径变化时重新打开，改为空时恢复写入主日志
+	var newAccess *logWriter
+	accessChanged := newCfg.AccessLogFile != old.AccessLogFile
+	if accessChanged && newCfg.AccessLogFile != "" {
+		newAccess, err = newLogWriter(newCfg.AccessLogFile, newCfg.LogMaxSizeMB, newCfg.LogMaxBackups)
+		if err != nil {
+			if newLog != nil {
+				newLog.Close()
+			}
+			return err
+		}
+	}
+
+	configMu.Lock()
+	config = newCfg
+	oldLog, oldAccess := logFile, accessLogFile
+	if newLog != nil {
+		logFile = newLog
+	} else {
+		logFile.setLimits(newCfg.LogMaxSizeMB, newCfg.LogMaxBackups)
+	}
+	if accessChanged {
+		accessLogFile = newAccess
+	} else if accessLogFile != nil {
+		accessLogFile.setLimits(newCfg.LogMaxSizeMB, newCfg.LogMaxBackups)
+	}
+	// 先切换输出再关闭旧文件，避免其他 goroutine 写入已关闭的文件
+	setLogOutputs()
+	if newLog != nil {
+		oldLog.Close()
+	}
+	if accessChanged && oldAccess != nil {
+		oldAccess.Close()
+	}
+	configMu.Unlock()
+	inheritHealth(lb.backends, activeBalancer.Load().backends)
+	inheritHealth(rt.backends, activeRouter.Load().backends)
+	inheritHealth(hb.list(), activeHosts.Load().list())
+	if cb != nil && activeCanary.Load() != nil {
+		inheritHealth([]*backend{cb}, []*backend{activeCanary.Load()})
+	}
+	activeBalancer.Store(lb)
+	activeRouter.Store(rt)
+	activeHosts.Store(hb)
+	activeCanary.Store(cb)
+	activeACL.Store(acl)
+	activeGeo.Store(newGeoFilter(activeGeo.Load().database(), newCfg.AllowedCountries, newCfg.BlockedCountries))
+	activeJWT.Store(jv)
+	if newCfg.MaxConcurrentRequests != old.MaxConcurrentRequests {
+		activeSemaphore.Store(newSemaphore(newCfg.MaxConcurrentRequests))
+	}
+
+	log.Println("Config reloaded")
+	return nil
+}
+
+// staticFields 只在启动时生效的配置项（监听、证书、TLS 握手、服务器超时、上游连接池、响应刷新间隔、日志格式、追踪导出和 GeoIP 数据库），重载时保留旧值
+// 证书文件内容更新由 certCache 自动加载，不需要重载
+var staticFields = []string{
+	"CertFile", "KeyFile",
+	"ACMEDomains", "ACMECacheDir", "ACMEEmail",
+	"TLSMinVersion", "TLSMaxVersion", "CipherSuites",
+	"ClientCAFile", "RequireClientCert",
+	"ListenAddr", "HTTPRedirectAddr", "HTTPListenAddr", "EnableHTTP3", "DisableHTTP2", "LogFormat", "LogTimeFormat", "LogTarget", "SyslogAddr",
+	"ReadTimeout", "ReadHeaderTimeout", "WriteTimeout", "IdleTimeout", "MaxHeaderBytes",
+	"MaxIdleConns", "MaxIdleConnsPerHost", "IdleConnTimeout", "UpstreamCAFile", "UpstreamInsecureSkipVerify",
+	"OTLPEndpoint", "FlushInterval", "WatchConfig", "GeoDBPath", "LogBufferSize", "EnableProxyProtocol",
+}
+
+// keepStaticFields 将 staticFields 中发生变化的字段恢复为旧值，并记录被忽略的字段
+func keepStaticFields(newCfg *Config, old Config) {
+	nv := reflect.ValueOf(newCfg).Elem()
+	ov := reflect.ValueOf(old)
+	for _, name := range staticFields {
+		if !reflect.DeepEqual(nv.FieldByName(name).Interface(), ov.FieldByName(name).Interface()) {
+			log.Printf("%s cannot change at runtime, ignored until restart", name)
+			nv.FieldByName(name).Set(ov.FieldByName(name))
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+)
+
+// requestIDHeader 传递请求 ID 的请求头
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen 客户端传入的请求 ID 最大长度，超出时重新生成
+const maxRequestIDLen = 128
+
+// newRequestID 生成随机的 UUID v4 作为请求 ID
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40 // 版本 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 变体
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// requestID 优先使用客户端传入的 X-Request-ID，不合法（过长或含特殊字符）时重新生成
+// 只接受字母、数字和 "-_.:"，避免日志注入和破坏 JSON 响应
+func requestID(incoming string) string {
+	if incoming == "" || len(incoming) > maxRequestIDLen {
+		return newRequestID()
+	}
+	for _, c := range incoming {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.:", c)) {
+			return newRequestID()
+		}
+	}
+	return incoming
+}
+
+// withRequestID 在 JSON 对象响应中追加 request_id 字段，非对象内容原样返回
+func withRequestID(body, id string) string {
+	return withJSONField(body, "request_id", id)
+}
+
+// withJSONField 在 JSON 对象末尾追加一个字符串字段，非对象内容原样返回
+func withJSONField(body, key, value string) string {
+	trimmed := strings.TrimSpace(body)
+	if !strings.HasPrefix(trimmed, "{") || !strings.HasSuffix(trimmed, "}") {
+		return body
+	}
+	inner := strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+	if inner == "" {
+		return fmt.Sprintf(`{%q: %q}`, key, value)
+	}
+	return fmt.Sprintf(`{%s, %q: %q}`, inner, key, value)
+}
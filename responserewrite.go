@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ResponseRewrite 改写上游响应内容的规则，按字符串替换（如把内部主机名换成对外域名）
+type ResponseRewrite struct {
+	From         string   `json:"From"`         // 要替换的字符串（如 "http://10.0.0.5:8080"）
+	To           string   `json:"To"`           // 替换后的字符串（如 "https://api.example.com"）
+	ContentTypes []string `json:"ContentTypes"` // 生效的内容类型，支持 "text/*" 通配，默认 application/json
+}
+
+// defaultRewriteTypes 未配置 ContentTypes 时改写的内容类型
+var defaultRewriteTypes = []string{"application/json"}
+
+// maxRewriteBytes 参与改写的响应体（解压后）上限，超过时原样返回
+const maxRewriteBytes = 10 << 20
+
+// rewriteResponse 在 ModifyResponse 中按顺序应用匹配内容类型的规则，
+// 重新计算 Content-Length；gzip 响应先解压，改写后再压缩，其他压缩格式原样返回
+func rewriteResponse(resp *http.Response, rules []ResponseRewrite) error {
+	if resp.Request.Method == http.MethodHead || resp.StatusCode == http.StatusPartialContent ||
+		resp.Body == nil || resp.Body == http.NoBody {
+		return nil
+	}
+	var active []ResponseRewrite
+	contentType := resp.Header.Get("Content-Type")
+	for _, rule := range rules {
+		types := rule.ContentTypes
+		if len(types) == 0 {
+			types = defaultRewriteTypes
+		}
+		if matchContentType(types, contentType) {
+			active = append(active, rule)
+		}
+	}
+	if len(active) == 0 {
+		return nil
+	}
+	encoding := strings.ToLower(resp.Header.Get("Content-Encoding"))
+	if encoding != "" && encoding != "identity" && encoding != "gzip" {
+		return nil
+	}
+	if resp.ContentLength > maxRewriteBytes {
+		return nil
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxRewriteBytes+1))
+	if err != nil {
+		return err
+	}
+	if len(raw) > maxRewriteBytes {
+		resp.Body = &replayBody{Reader: io.MultiReader(bytes.NewReader(raw), resp.Body), Closer: resp.Body}
+		return nil
+	}
+	resp.Body.Close()
+	// 出现问题时保留已读取的原始内容
+	resp.Body = io.NopCloser(bytes.NewReader(raw))
+
+	body := raw
+	if encoding == "gzip" {
+		zr, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return err
+		}
+		body, err = io.ReadAll(io.LimitReader(zr, maxRewriteBytes+1))
+		if err != nil {
+			return err
+		}
+		if len(body) > maxRewriteBytes {
+			return nil
+		}
+	}
+	for _, rule := range active {
+		body = bytes.ReplaceAll(body, []byte(rule.From), []byte(rule.To))
+	}
+	if encoding == "gzip" {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(body)
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Del("Transfer-Encoding")
+	// 内容已改变，上游的强校验 ETag 不再有效
+	resp.Header.Del("ETag")
+	return nil
+}
+
+// replayBody 先返回已读取的部分，再继续读取原响应体
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
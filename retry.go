@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"sync/atomic"
+	"time"
+)
+
+// defaultRetryBackoff 未配置 RetryBackoff 时首次重试前的等待时间
+const defaultRetryBackoff = 100 * time.Millisecond
+
+// maxRetryBodyBytes 按状态码重试时缓存的请求体上限，更大的请求体只发送一次
+const maxRetryBodyBytes = 1 << 20
+
+// retryTransport 在上游连接失败时对幂等请求按指数退避重试，
+// 上游返回 RetryOnStatus 中的状态码时同样重试
+type retryTransport struct {
+	next http.RoundTripper
+}
+
+// isIdempotent 判断请求方法是否可以安全重试
+func isIdempotent(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+// retryableOnStatus 判断上游已处理过的请求能否按状态码重试，包括带请求体的幂等方法
+func retryableOnStatus(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// retryOn 判断状态码是否在 RetryOnStatus 中
+func (c Config) retryOn(status int) bool {
+	for _, code := range c.RetryOnStatus {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
+
+// RoundTrip 实现 http.RoundTripper，非幂等请求只发送一次
+// 重试都发生在响应交给 ReverseProxy 之前，只有 1xx 响应可能已经转发给客户端，此时不再按状态码重试
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	cfg := loadConfig()
+	onStatus := len(cfg.RetryOnStatus) > 0 && cfg.MaxRetries > 0 && retryableOnStatus(req.Method)
+
+	var body []byte
+	var informed atomic.Bool
+	if onStatus {
+		var ok bool
+		if body, ok = bufferRequestBody(req); !ok {
+			onStatus = false
+		}
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+			Got1xxResponse: func(int, textproto.MIMEHeader) error {
+				informed.Store(true)
+				return nil
+			},
+		}))
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	retry := func() bool {
+		if err != nil {
+			return isIdempotent(req.Method)
+		}
+		return onStatus && cfg.retryOn(resp.StatusCode) && !informed.Load()
+	}
+
+	backoff := cfg.retryBackoff()
+	for attempt := 1; attempt <= cfg.MaxRetries && retry(); attempt++ {
+		if resp != nil {
+			// 丢弃失败的响应，读完响应体以便复用连接
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+
+		if body != nil {
+			req.Body = keepCapture(req.Body, io.NopCloser(bytes.NewReader(body)))
+		}
+		resp, err = t.next.RoundTrip(req)
+	}
+	return resp, err
+}
+
+// bufferRequestBody 读取请求体以便重试时重新发送，超过 maxRetryBodyBytes 时恢复请求体并返回 false
+// 替换后的请求体保留 DebugBodyLog 的记录包装，见 keepCapture
+func bufferRequestBody(req *http.Request) ([]byte, bool) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true
+	}
+	if req.ContentLength > maxRetryBodyBytes {
+		return nil, false
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxRetryBodyBytes+1))
+	if err != nil || len(body) > maxRetryBodyBytes {
+		req.Body = keepCapture(req.Body, &replayBody{Reader: io.MultiReader(bytes.NewReader(body), req.Body), Closer: req.Body})
+		return nil, false
+	}
+	req.Body.Close()
+	req.Body = keepCapture(req.Body, io.NopCloser(bytes.NewReader(body)))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, true
+}
+
+// keepCapture 替换请求体时保留 DebugBodyLog 的 captureBody 包装，否则 logBodies 找不到记录的请求体
+// 新的包装从头记录实际发送的内容，每次重试都重新记录，不会重复
+func keepCapture(orig, body io.ReadCloser) io.ReadCloser {
+	if cb, ok := orig.(*captureBody); ok {
+		return &captureBody{ReadCloser: body, limit: cb.limit}
+	}
+	return body
+}
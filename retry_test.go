@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer 供 log 输出并发写入的缓冲区
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLog 把 log 包的输出重定向到缓冲区，测试结束后恢复
+func captureLog(t *testing.T) *syncBuffer {
+	t.Helper()
+	buf := &syncBuffer{}
+	prev := log.Writer()
+	log.SetOutput(buf)
+	t.Cleanup(func() { log.SetOutput(prev) })
+	return buf
+}
+
+func TestRetryOnStatusKeepsDebugBodyLog(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	var bodies []string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		attempts++
+		n := attempts
+		bodies = append(bodies, string(data))
+		mu.Unlock()
+		if n == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "stored")
+	}))
+	defer backend.Close()
+
+	proxy := newTestProxy(t, Config{
+		RpAddr:        backend.URL,
+		RpPath:        "/items",
+		DebugBodyLog:  true,
+		RetryOnStatus: []int{http.StatusServiceUnavailable},
+		MaxRetries:    1,
+		RetryBackoff:  Duration(time.Millisecond),
+	})
+	logs := captureLog(t)
+
+	req, _ := http.NewRequest("PUT", proxy.URL+"/items", strings.NewReader(`{"name":"widget"}`))
+	req.Header.Set("x-flag", "secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200 after retry", resp.StatusCode)
+	}
+	mu.Lock()
+	if len(bodies) != 2 || bodies[0] != bodies[1] || bodies[1] != `{"name":"widget"}` {
+		t.Errorf("upstream received bodies %q, want the request body twice", bodies)
+	}
+	mu.Unlock()
+
+	// 响应体关闭后才记录日志，稍等记录完成
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(logs.String(), "Debug body PUT") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	out := logs.String()
+	if !strings.Contains(out, `body="{\"name\":\"widget\"}" response 200`) {
+		t.Errorf("debug log does not contain the request body:\n%s", out)
+	}
+}
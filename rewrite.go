@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// PathRewrite 转发前改写请求路径的规则
+type PathRewrite struct {
+	From  string `json:"From"`  // 要替换的路径前缀（如 "/api"），Regex 为 true 时为正则表达式
+	To    string `json:"To"`    // 替换后的前缀（如 "/internal/api"），正则模式下可用 $1 引用分组
+	Regex bool   `json:"Regex"` // 是否按正则表达式替换
+}
+
+// replacePrefix 按路径段把 from 前缀替换为 to，"/api" 匹配 "/api" 和 "/api/x" 但不匹配 "/apix"
+// 前缀末尾的 "/" 不影响匹配；不匹配时返回原路径
+func replacePrefix(path, from, to string) string {
+	from = strings.TrimSuffix(from, "/")
+	if !strings.HasPrefix(path, from) {
+		return path
+	}
+	rest := path[len(from):]
+	if rest != "" && rest[0] != '/' {
+		return path
+	}
+	if p := strings.TrimSuffix(to, "/") + rest; p != "" {
+		return p
+	}
+	return "/"
+}
+
+// rewritePath 在 Director 中改写转发给上游的路径，先去掉匹配的前缀（StripPrefix），再应用 RewritePath
+// 只改写转发的请求，访问日志仍记录客户端请求的原始路径；查询参数保持不变
+func rewritePath(req *http.Request, cfg Config, prefix string) {
+	path := req.URL.Path
+	if cfg.StripPrefix && prefix != "" {
+		path = replacePrefix(path, prefix, "/")
+	}
+	switch {
+	case cfg.rewriteRe != nil:
+		path = cfg.rewriteRe.ReplaceAllString(path, cfg.RewritePath.To)
+	case cfg.RewritePath.From != "":
+		path = replacePrefix(path, cfg.RewritePath.From, cfg.RewritePath.To)
+	}
+	if path != req.URL.Path {
+		req.URL.Path = path
+		req.URL.RawPath = ""
+	}
+}
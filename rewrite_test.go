@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReplacePrefix(t *testing.T) {
+	tests := []struct {
+		path, from, to string
+		want           string
+	}{
+		{"/api", "/api", "/v1", "/v1"},
+		{"/api/users", "/api", "/v1", "/v1/users"},
+		{"/api/users", "/api/", "/v1", "/v1/users"},
+		{"/api/users", "/api", "/v1/", "/v1/users"},
+		{"/api/", "/api", "/v1", "/v1/"},
+		{"/apix", "/api", "/v1", "/apix"},
+		{"/other", "/api", "/v1", "/other"},
+		// 剩余部分为空且目标为根时返回 "/"
+		{"/api", "/api", "/", "/"},
+		{"/api", "/api", "", "/"},
+		{"/api/users", "/api", "/", "/users"},
+	}
+	for _, tt := range tests {
+		if got := replacePrefix(tt.path, tt.from, tt.to); got != tt.want {
+			t.Errorf("replacePrefix(%q, %q, %q) = %q, want %q", tt.path, tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestRewritePath(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       Config
+		prefix    string
+		url       string
+		wantPath  string
+		wantQuery string
+	}{
+		{"strip prefix", Config{StripPrefix: true}, "/api", "/api/users?id=1", "/users", "id=1"},
+		{"strip prefix with slash", Config{StripPrefix: true}, "/api/", "/api/users", "/users", ""},
+		{"strip whole path", Config{StripPrefix: true}, "/api", "/api?x=y", "/", "x=y"},
+		{"strip disabled", Config{}, "/api", "/api/users", "/api/users", ""},
+		{"prefix rewrite", Config{RewritePath: PathRewrite{From: "/old", To: "/new"}}, "", "/old/a?b=c", "/new/a", "b=c"},
+		{"prefix rewrite no match", Config{RewritePath: PathRewrite{From: "/old", To: "/new"}}, "", "/older", "/older", ""},
+		{"strip then rewrite", Config{StripPrefix: true, RewritePath: PathRewrite{From: "/v1", To: "/v2"}}, "/api", "/api/v1/x?q=1", "/v2/x", "q=1"},
+		{"regex rewrite", Config{RewritePath: PathRewrite{From: `^/users/(\d+)$`, To: "/u/$1", Regex: true}}, "", "/users/42?full=1", "/u/42", "full=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			if err := cfg.resolve(); err != nil {
+				t.Fatalf("resolve: %v", err)
+			}
+			req := httptest.NewRequest("GET", tt.url, nil)
+			rewritePath(req, cfg, tt.prefix)
+			if req.URL.Path != tt.wantPath {
+				t.Errorf("path = %q, want %q", req.URL.Path, tt.wantPath)
+			}
+			if req.URL.RawQuery != tt.wantQuery {
+				t.Errorf("query = %q, want %q", req.URL.RawQuery, tt.wantQuery)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+)
+
+// Route 一条访问规则：路径和请求头标识都匹配时转发到 Target，按顺序取第一条完全匹配的规则
+// 不同客户端可以使用各自的请求头名称和标识访问各自的后端
+type Route struct {
+	Path         string `json:"Path"`         // 匹配路径，规则同 RpPaths（受 PathPrefixMatch 影响）
+	CfHeader     string `json:"CfHeader"`     // 要求的请求头标识
+	CfHeaderName string `json:"CfHeaderName"` // 携带请求头标识的请求头名称，为空时使用全局的 CfHeaderName
+	Target       string `json:"Target"`       // 转发目标地址
+
+	RateLimitRPS   float64 `json:"RateLimitRPS"`   // 该路径每个客户端 IP 每秒允许的请求数，0 表示使用全局限流
+	RateLimitBurst int     `json:"RateLimitBurst"` // 该路径的令牌桶容量
+}
+
+// router 按顺序匹配路由规则，每条规则对应一个已解析的代理目标
+type router struct {
+	routes   []Route
+	backends []*backend
+}
+
+// activeRouter 当前生效的路由表，配置重载时整体替换
+var activeRouter atomic.Pointer[router]
+
+// newRouter 解析每条路由的转发目标
+func newRouter(routes []Route) (*router, error) {
+	rt := &router{routes: routes}
+	for _, route := range routes {
+		b, err := newBackend(route.Target)
+		if err != nil {
+			return nil, err
+		}
+		b.path = route.Path
+		rt.backends = append(rt.backends, b)
+	}
+	return rt, nil
+}
+
+// match 返回第一条路径和请求头标识都匹配的路由目标（authOK 时只看路径），没有匹配时返回 nil
+// cfHeader 为全局 CfHeaderName 请求头的值，规则单独指定了请求头名称时从请求中读取
+func (rt *router) match(cfg Config, r *http.Request, cfHeader string, authOK bool) *backend {
+	for i, route := range rt.routes {
+		value := cfHeader
+		if route.CfHeaderName != "" {
+			value = r.Header.Get(route.CfHeaderName)
+		}
+		if (authOK || secretEqual(value, route.CfHeader)) && cfg.matchPath([]string{route.Path}, r.URL.Path) {
+			return rt.backends[i]
+		}
+	}
+	return nil
+}
+
+// backendKey 在请求上下文中保存已选定代理目标的键
+type backendKey struct{}
+
+// withBackend 将选定的代理目标放入请求上下文，由 Director 读取
+func withBackend(r *http.Request, b *backend) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), backendKey{}, b))
+}
+
+// selectedBackend 返回请求上下文中已选定的代理目标
+func selectedBackend(r *http.Request) *backend {
+	b, _ := r.Context().Value(backendKey{}).(*backend)
+	return b
+}
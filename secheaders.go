@@ -0,0 +1,61 @@
+package main
+
+import "net/http"
+
+// SecurityHeadersConfig 安全响应头配置，启用后添加到所有响应，上游返回的同名响应头会被替换
+type SecurityHeadersConfig struct {
+	Enabled               bool   `json:"Enabled"`               // 是否添加安全响应头
+	HSTS                  string `json:"HSTS"`                  // Strict-Transport-Security 的值，默认 "max-age=31536000"，设为 "off" 不添加
+	NoSniff               *bool  `json:"NoSniff"`               // 是否添加 X-Content-Type-Options: nosniff，默认 true
+	FrameOptions          string `json:"FrameOptions"`          // X-Frame-Options 的值，默认 "DENY"，设为 "off" 不添加
+	ContentSecurityPolicy string `json:"ContentSecurityPolicy"` // Content-Security-Policy 的值，为空不添加
+}
+
+// 安全响应头默认值，服务只监听 TLS，默认开启一年的 HSTS
+const (
+	defaultHSTS         = "max-age=31536000"
+	defaultFrameOptions = "DENY"
+)
+
+// headers 返回需要添加的响应头，未启用时返回 nil
+func (c SecurityHeadersConfig) headers() map[string]string {
+	if !c.Enabled {
+		return nil
+	}
+	h := map[string]string{}
+	switch c.HSTS {
+	case "":
+		h["Strict-Transport-Security"] = defaultHSTS
+	case "off":
+	default:
+		h["Strict-Transport-Security"] = c.HSTS
+	}
+	if c.NoSniff == nil || *c.NoSniff {
+		h["X-Content-Type-Options"] = "nosniff"
+	}
+	switch c.FrameOptions {
+	case "":
+		h["X-Frame-Options"] = defaultFrameOptions
+	case "off":
+	default:
+		h["X-Frame-Options"] = c.FrameOptions
+	}
+	if c.ContentSecurityPolicy != "" {
+		h["Content-Security-Policy"] = c.ContentSecurityPolicy
+	}
+	return h
+}
+
+// setSecurityHeaders 为响应添加安全响应头
+func setSecurityHeaders(h http.Header, c SecurityHeadersConfig) {
+	for k, v := range c.headers() {
+		h.Set(k, v)
+	}
+}
+
+// stripUpstreamSecurityHeaders 删除上游返回的同名安全响应头，避免与本服务设置的值重复
+func stripUpstreamSecurityHeaders(h http.Header, c SecurityHeadersConfig) {
+	for k := range c.headers() {
+		h.Del(k)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// defaultUpstreamCheckTimeout 未配置 UpstreamCheckTimeout 时连接上游的超时时间
+const defaultUpstreamCheckTimeout = 5 * time.Second
+
+// checkUpstreams 启动时尝试与每个上游建立 TCP 连接，不可达的记录警告并汇总返回
+func checkUpstreams(cfg Config) error {
+	timeout := time.Duration(cfg.UpstreamCheckTimeout)
+	if timeout <= 0 {
+		timeout = defaultUpstreamCheckTimeout
+	}
+
+	var unreachable []string
+	for _, addr := range cfg.upstreamAddrs() {
+		u, err := parseTarget(addr)
+		if err != nil {
+			unreachable = append(unreachable, addr)
+			continue
+		}
+		network, dialAddr := "tcp", hostPort(u)
+		if path, ok := unixSocketFor(u.Hostname()); ok {
+			network, dialAddr = "unix", path
+		}
+		conn, err := net.DialTimeout(network, dialAddr, timeout)
+		if err != nil {
+			log.Printf("Warning: upstream %s is unreachable: %v", addr, err)
+			unreachable = append(unreachable, addr)
+			continue
+		}
+		conn.Close()
+	}
+
+	if len(unreachable) > 0 {
+		return fmt.Errorf("unreachable upstreams: %s", strings.Join(unreachable, ", "))
+	}
+	return nil
+}
+
+// hostPort 返回 URL 的 host:port，未写端口时按协议补全默认端口
+func hostPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
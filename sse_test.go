@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerSentEventsStreamed(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"plain", Config{}},
+		{"compression", Config{Compression: CompressionConfig{Enabled: true, MinSize: 1}}},
+		{"handler timeout", Config{HandlerTimeout: Duration(5 * time.Second)}},
+	}
+	const events = 3
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 上游逐个发送事件，每发一个都等客户端确认收到后再发下一个；
+			// 代理缓冲了响应时客户端收不到事件，上游会一直等到超时
+			received := make(chan struct{})
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Header().Set("Cache-Control", "no-cache")
+				for i := 0; i < events; i++ {
+					fmt.Fprintf(w, "data: event %d\n\n", i)
+					w.(http.Flusher).Flush()
+					select {
+					case <-received:
+					case <-time.After(3 * time.Second):
+						t.Errorf("event %d was not delivered before the stream ended", i)
+						return
+					}
+				}
+			}))
+			defer backend.Close()
+
+			cfg := tt.cfg
+			cfg.RpAddr = backend.URL
+			cfg.RpPath = "/events"
+			proxy := newTestProxy(t, cfg)
+
+			req, _ := http.NewRequest("GET", proxy.URL+"/events", nil)
+			req.Header.Set("x-flag", "secret")
+			req.Header.Set("Accept", "text/event-stream")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, want 200", resp.StatusCode)
+			}
+
+			br := bufio.NewReader(resp.Body)
+			for i := 0; i < events; i++ {
+				line, err := br.ReadString('\n')
+				if err != nil {
+					t.Fatalf("read event %d: %v", i, err)
+				}
+				if want := fmt.Sprintf("data: event %d", i); strings.TrimSpace(line) != want {
+					t.Fatalf("event %d = %q, want %q", i, line, want)
+				}
+				br.ReadString('\n') // 事件之间的空行
+				received <- struct{}{}
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+)
+
+// 会话保持方式
+const (
+	stickyIP     = "ip"     // 按客户端 IP 哈希固定目标
+	stickyCookie = "cookie" // 通过 Cookie 记录并固定目标
+)
+
+// stickyCookieName 记录所选目标的 Cookie 名称，值为目标地址的哈希，不暴露内部地址
+const stickyCookieName = "goweb_backend"
+
+// hashString 计算字符串的 FNV-1a 哈希
+func hashString(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
+
+// stickyID 返回目标在 Cookie 中的标识
+func (be *backend) stickyID() string {
+	return strconv.FormatUint(uint64(hashString(be.target.String())), 36)
+}
+
+// sticky 按 Stickiness 选出目标：ip 模式对客户端 IP 取哈希，cookie 模式使用 Cookie 中记录的目标，
+// consistent-hash 模式在哈希环上查找（选中的目标不可用时落到环上的下一个目标）
+// 固定的目标不可用或 Cookie 无效时退回 next；pinned 为 false 表示需要重新下发 Cookie
+func (b *balancer) sticky(cfg Config, r *http.Request, ip string) (be *backend, pinned bool) {
+	switch cfg.Stickiness {
+	case stickyIP:
+		be = b.backends[hashString(ip)%uint32(len(b.backends))]
+		if !be.down.Load() {
+			return be, true
+		}
+	case stickyHash:
+		if be = b.ring.lookup(cfg.hashKey(r, ip)); be != nil {
+			return be, true
+		}
+	case stickyCookie:
+		if c, err := r.Cookie(stickyCookieName); err == nil {
+			for _, be := range b.backends {
+				if be.stickyID() == c.Value && !be.down.Load() {
+					return be, true
+				}
+			}
+		}
+	}
+	return b.next(), false
+}
+
+// pinBackend 为未命中路由的请求按会话保持选择目标，cookie 模式下目标变化时下发新的 Cookie
+func pinBackend(cfg Config, w http.ResponseWriter, r *http.Request, ip string) *http.Request {
+	be, pinned := activeBalancer.Load().sticky(cfg, r, ip)
+	if cfg.Stickiness == stickyCookie && !pinned {
+		http.SetCookie(w, &http.Cookie{
+			Name:     stickyCookieName,
+			Value:    be.stickyID(),
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	return r.WithContext(context.WithValue(r.Context(), pinnedKey{}, be))
+}
+
+// pinnedKey 在请求上下文中保存会话保持选定目标的键
+type pinnedKey struct{}
+
+// pinnedBackend 返回会话保持选定的目标，未启用时返回 nil
+func pinnedBackend(r *http.Request) *backend {
+	be, _ := r.Context().Value(pinnedKey{}).(*backend)
+	return be
+}
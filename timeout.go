@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// errUpstreamTimeout 上游在 UpstreamTimeout 内没有返回响应头
+var errUpstreamTimeout = errors.New("upstream timeout")
+
+// gatewayTimeoutBody 上游超时返回的内容
+const gatewayTimeoutBody = `{"error": "gateway timeout", "message": "The upstream did not respond in time"}`
+
+// timeoutTransport 为转发的请求设置截止时间，UpstreamTimeout 内未收到响应头时取消请求
+// 只限制等待响应头（含重试）的时间，收到响应后计时停止，流式响应和 WebSocket 不受影响
+// 101 响应的响应体是可写的升级连接，ReverseProxy 需要 io.ReadWriteCloser，不能再包装
+type timeoutTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip 实现 http.RoundTripper，UpstreamTimeout 为 0 时不限制
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	timeout := time.Duration(loadConfig().UpstreamTimeout)
+	if timeout <= 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithCancelCause(req.Context())
+	timer := time.AfterFunc(timeout, func() { cancel(errUpstreamTimeout) })
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if !timer.Stop() {
+		// 计时器已触发，即使刚好拿到响应，上下文也已取消，按超时处理
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, errUpstreamTimeout
+	}
+	if err != nil {
+		cancel(nil)
+		return nil, err
+	}
+	// 升级后的连接在请求结束（处理函数返回）时随父上下文一起释放
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		return resp, nil
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose 响应体关闭时释放请求上下文
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelCauseFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel(nil)
+	return err
+}
+
+// handlerTimeoutBody 转发阶段超过 HandlerTimeout 时返回的内容
+const handlerTimeoutBody = `{"error": "service unavailable", "message": "The request took too long to process"}`
+
+// handlerTimeoutApplies 判断请求是否受 HandlerTimeout 限制
+// http.TimeoutHandler 会缓冲整个响应且不支持 Hijack，WebSocket、SSE 和 HandlerTimeoutExcludePaths 中的路径不做限制
+func (c Config) handlerTimeoutApplies(r *http.Request) bool {
+	if c.HandlerTimeout <= 0 || isWebSocketUpgrade(r) {
+		return false
+	}
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		return false
+	}
+	return !c.matchPath(c.HandlerTimeoutExcludePaths, r.URL.Path)
+}
+
+// withHandlerTimeout 用 http.TimeoutHandler 限制转发阶段（压缩、缓存、代理）的总时间，超时返回 503
+// 超时响应和其他代理错误一样经过 writeProxyError，带上 request_id 并应用 ErrorResponses 模板
+func withHandlerTimeout(cfg Config, next http.Handler) http.Handler {
+	timeout := time.Duration(cfg.HandlerTimeout)
+	th := http.TimeoutHandler(next, timeout, handlerTimeoutBody)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !cfg.handlerTimeoutApplies(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// 与 TimeoutHandler 使用相同的截止时间，用于识别超时响应
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		th.ServeHTTP(&timeoutErrorWriter{ResponseWriter: w, r: r, cfg: cfg, ctx: ctx}, r.WithContext(ctx))
+	})
+}
+
+// timeoutErrorWriter 把 TimeoutHandler 写出的超时响应替换为 writeProxyError 的输出
+// 超时响应由 TimeoutHandler 直接写入，此时截止时间已过；正常完成的响应不受影响
+type timeoutErrorWriter struct {
+	http.ResponseWriter
+	r        *http.Request
+	cfg      Config
+	ctx      context.Context
+	timedOut bool // 已写出替换后的超时响应，丢弃 TimeoutHandler 随后写入的内容
+}
+
+func (w *timeoutErrorWriter) WriteHeader(code int) {
+	if code == http.StatusServiceUnavailable && errors.Is(w.ctx.Err(), context.DeadlineExceeded) {
+		w.timedOut = true
+		writeProxyError(w.ResponseWriter, w.r, w.cfg, code, handlerTimeoutBody)
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *timeoutErrorWriter) Write(p []byte) (int, error) {
+	if w.timedOut {
+		return len(p), nil
+	}
+	return w.ResponseWriter.Write(p)
+}
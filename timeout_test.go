@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandlerTimeoutResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		templates  map[string]ErrorResponse
+		wantStatus int
+		wantError  string
+	}{
+		{"default body", nil, http.StatusServiceUnavailable, "service unavailable"},
+		{
+			"error response template",
+			map[string]ErrorResponse{"503": {Body: `{"error": "busy", "message": "try again later"}`, Status: http.StatusGatewayTimeout}},
+			http.StatusGatewayTimeout,
+			"busy",
+		},
+		{
+			"class template",
+			map[string]ErrorResponse{"5xx": {Body: `{"error": "server error", "message": "upstream failed"}`}},
+			http.StatusServiceUnavailable,
+			"server error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release := make(chan struct{})
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				<-release
+			}))
+			defer backend.Close()
+			defer close(release)
+
+			proxy := newTestProxy(t, Config{
+				RpAddr:         backend.URL,
+				RpPath:         "/slow",
+				HandlerTimeout: Duration(50 * time.Millisecond),
+				ErrorResponses: tt.templates,
+			})
+			req, _ := http.NewRequest("GET", proxy.URL+"/slow", nil)
+			req.Header.Set("x-flag", "secret")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			data, _ := io.ReadAll(resp.Body)
+			var body map[string]string
+			if err := json.Unmarshal(data, &body); err != nil {
+				t.Fatalf("body %q is not JSON: %v", data, err)
+			}
+			if body["error"] != tt.wantError {
+				t.Errorf("error = %q, want %q", body["error"], tt.wantError)
+			}
+			if body["request_id"] == "" || body["request_id"] != resp.Header.Get(requestIDHeader) {
+				t.Errorf("request_id = %q, want response header %q", body["request_id"], resp.Header.Get(requestIDHeader))
+			}
+		})
+	}
+}
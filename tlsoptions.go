@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+)
+
+// tlsVersions 配置中的 TLS 版本名称与常量的对应关系
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLSVersion 解析 "1.2"、"1.3" 这样的版本名，为空时返回默认值
+func parseTLSVersion(name string, def uint16) (uint16, error) {
+	if name == "" {
+		return def, nil
+	}
+	v, ok := tlsVersions[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q, use one of 1.0, 1.1, 1.2, 1.3", name)
+	}
+	return v, nil
+}
+
+// tlsVersionName 返回 TLS 版本常量对应的名称（如 "TLS1.3"），未知版本返回十六进制值
+func tlsVersionName(v uint16) string {
+	for name, id := range tlsVersions {
+		if id == v {
+			return "TLS" + name
+		}
+	}
+	return fmt.Sprintf("0x%04x", v)
+}
+
+// parseCipherSuites 将加密套件名称（如 "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"）转换为常量
+// 为空时返回 nil 使用 Go 的默认套件；TLS 1.3 的套件不可配置，会被忽略
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, cs := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		known[cs.Name] = cs.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// nextProtos 返回 ALPN 协商的协议列表，DisableHTTP2 时只保留 http/1.1
+func (c Config) nextProtos() []string {
+	if c.DisableHTTP2 {
+		return []string{"http/1.1"}
+	}
+	return []string{"h2", "http/1.1"}
+}
+
+// tlsNextProto DisableHTTP2 时返回非 nil 的空表，http.Server 不会再自动启用 HTTP/2；否则返回 nil 使用默认行为
+func (c Config) tlsNextProto() map[string]func(*http.Server, *tls.Conn, http.Handler) {
+	if c.DisableHTTP2 {
+		return map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer 代理请求的追踪器，未配置 OTLPEndpoint 时为 nil，处理请求时直接跳过
+var tracer trace.Tracer
+
+// setupTracing 按 OTLPEndpoint（如 "http://otel-collector:4318"）创建 OTLP/HTTP 导出器并启用追踪
+// 返回的函数在退出前调用，把尚未导出的 span 发送出去；未启用时返回 nil
+func setupTracing(cfg Config) (func(context.Context) error, error) {
+	if cfg.OTLPEndpoint == "" {
+		return nil, nil
+	}
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(cfg.OTLPEndpoint))
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", "goweb")))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	tracer = provider.Tracer("goweb")
+	return provider.Shutdown, nil
+}
+
+// startSpan 为代理请求创建 span，沿用客户端带来的 traceparent；未启用追踪时原样返回
+func startSpan(r *http.Request) (*http.Request, trace.Span) {
+	if tracer == nil {
+		return r, nil
+	}
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer.Start(ctx, r.Method+" "+r.URL.Path,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path),
+			attribute.String("request.id", r.Header.Get(requestIDHeader)),
+		))
+	return r.WithContext(ctx), span
+}
+
+// endSpan 记录响应状态码并结束 span，5xx 标记为错误；耗时即 span 的时长
+func endSpan(span trace.Span, status int) {
+	if span == nil {
+		return
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+	if status >= 500 {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	span.End()
+}
+
+// injectTraceContext 在 Director 中把当前 span 的 traceparent 写入转发给上游的请求头
+func injectTraceContext(req *http.Request) {
+	if tracer == nil {
+		return
+	}
+	otel.GetTextMapPropagator().Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// 上游连接池的默认值，单个上游的空闲连接数比标准库默认的 2 大得多，避免高并发下频繁建连
+const (
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 100
+	defaultIdleConnTimeout     = 90 * time.Second
+)
+
+// upstreamTLSConfig 返回连接 HTTPS 上游的 TLS 设置：UpstreamCAFile 替换系统根证书，
+// UpstreamInsecureSkipVerify 跳过证书校验（仅用于开发环境）；都未配置时返回 nil 使用默认设置
+func upstreamTLSConfig(cfg Config) (*tls.Config, error) {
+	if cfg.UpstreamCAFile == "" && !cfg.UpstreamInsecureSkipVerify {
+		return nil, nil
+	}
+	tc := &tls.Config{InsecureSkipVerify: cfg.UpstreamInsecureSkipVerify}
+	if cfg.UpstreamCAFile != "" {
+		pem, err := os.ReadFile(cfg.UpstreamCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tc.RootCAs = x509.NewCertPool()
+		if !tc.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificates found in %s", cfg.UpstreamCAFile)
+		}
+	}
+	return tc, nil
+}
+
+// newTransport 按配置创建转发到上游使用的 http.Transport
+func newTransport(cfg Config) (*http.Transport, error) {
+	tc, err := upstreamTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if tc != nil {
+		t.TLSClientConfig = tc
+	}
+	t.MaxIdleConns = defaultMaxIdleConns
+	if cfg.MaxIdleConns > 0 {
+		t.MaxIdleConns = cfg.MaxIdleConns
+	}
+	t.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	if cfg.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	}
+	t.IdleConnTimeout = cfg.IdleConnTimeout.or(defaultIdleConnTimeout)
+	// 与标准库默认拨号参数相同，另外支持 unix: 上游
+	t.DialContext = dialUpstream(&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second})
+	return t, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+// benchmarkClients 并发客户端数，模拟单个上游承接大量并发请求
+const benchmarkClients = 500
+
+// BenchmarkUpstreamTransport 对比标准库默认 Transport（每个上游只保留 2 个空闲连接）与 newTransport 的连接池
+// 在 500 个并发客户端访问同一个上游时的吞吐，默认 Transport 大部分请求需要重新建连
+func BenchmarkUpstreamTransport(b *testing.B) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"status":"ok"}`)
+	}))
+	defer upstream.Close()
+
+	pooled, err := newTransport(Config{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, bc := range []struct {
+		name      string
+		transport *http.Transport
+	}{
+		{"default", http.DefaultTransport.(*http.Transport).Clone()},
+		{"pooled", pooled},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			defer bc.transport.CloseIdleConnections()
+			client := &http.Client{Transport: bc.transport}
+			// RunParallel 启动 parallelism*GOMAXPROCS 个 goroutine
+			b.SetParallelism((benchmarkClients + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0))
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					resp, err := client.Get(upstream.URL)
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+				}
+			})
+		})
+	}
+}
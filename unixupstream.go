@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// unixTargetPrefix 目标地址以此开头时转发到 Unix 套接字上的上游，如 "unix:/run/backend.sock"
+const unixTargetPrefix = "unix:"
+
+// unixHostSuffix Unix 套接字上游的占位主机名后缀，Transport 拨号时据此找到套接字路径
+// 每个套接字使用不同的占位主机名，连接池不会混用
+const unixHostSuffix = ".unix.invalid"
+
+// unixPlaceholderHost 转发到 Unix 套接字时请求的 Host 头
+const unixPlaceholderHost = "localhost"
+
+// unixSockets 占位主机名到套接字路径的映射，解析目标地址时登记
+var unixSockets sync.Map
+
+// parseTarget 解析目标地址，unix: 地址转换为 http://<占位主机名> 并登记对应的套接字路径
+func parseTarget(addr string) (*url.URL, error) {
+	path, ok := strings.CutPrefix(addr, unixTargetPrefix)
+	if !ok {
+		return url.Parse(addr)
+	}
+	if path == "" {
+		return nil, fmt.Errorf("unix target %q has no socket path", addr)
+	}
+	host := fmt.Sprintf("%08x%s", hashString(path), unixHostSuffix)
+	unixSockets.Store(host, path)
+	return &url.URL{Scheme: "http", Host: host}, nil
+}
+
+// unixSocketFor 返回占位主机名对应的套接字路径
+func unixSocketFor(host string) (string, bool) {
+	path, ok := unixSockets.Load(host)
+	if !ok {
+		return "", false
+	}
+	return path.(string), true
+}
+
+// upstreamHost 返回转发请求使用的 Host 头，Unix 套接字上游使用 localhost 代替占位主机名
+func upstreamHost(u *url.URL) string {
+	if _, ok := unixSocketFor(u.Hostname()); ok {
+		return unixPlaceholderHost
+	}
+	return u.Host
+}
+
+// dialUpstream 返回连接上游的拨号函数：占位主机名连接对应的 Unix 套接字，其余按原地址拨号
+func dialUpstream(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			if path, ok := unixSocketFor(host); ok {
+				return dialer.DialContext(ctx, "unix", path)
+			}
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
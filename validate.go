@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+// configErrors 汇总配置校验发现的所有问题，一次性报告
+type configErrors []string
+
+func (e configErrors) Error() string {
+	return "invalid config:\n  - " + strings.Join(e, "\n  - ")
+}
+
+// add 记录一条校验问题
+func (e *configErrors) add(format string, args ...interface{}) {
+	*e = append(*e, fmt.Sprintf(format, args...))
+}
+
+// validateConfig 检查必填项、代理目标地址和证书文件，返回所有发现的问题
+func validateConfig(c Config) error {
+	var errs configErrors
+
+	if len(c.Routes) > 0 {
+		if len(c.Hosts) > 0 {
+			errs.add("Hosts cannot be combined with Routes")
+		}
+		for i, route := range c.Routes {
+			if route.Path == "" {
+				errs.add("Routes[%d].Path is required", i)
+			}
+			checkTarget(&errs, route.Target)
+			if route.RateLimitRPS < 0 {
+				errs.add("Routes[%d].RateLimitRPS must not be negative", i)
+			}
+		}
+	} else {
+		if len(c.Hosts) > 0 {
+			for host, target := range c.Hosts {
+				if host == "" {
+					errs.add("Hosts must not contain an empty hostname")
+				}
+				checkTarget(&errs, target)
+			}
+		} else if c.RpAddr == "" && len(c.RpAddrs) == 0 && len(c.RpTargets) == 0 {
+			errs.add("RpAddr, RpAddrs or RpTargets is required")
+		} else {
+			for _, addr := range c.targetAddrs() {
+				checkTarget(&errs, addr)
+			}
+		}
+		for i, t := range c.RpTargets {
+			if t.Weight < 0 {
+				errs.add("RpTargets[%d].Weight must not be negative", i)
+			}
+		}
+		if c.RpPath == "" && len(c.RpPaths) == 0 {
+			errs.add("RpPath or RpPaths is required")
+		}
+	}
+	switch c.logTarget() {
+	case logTargetFile:
+		if c.LogFile == "" {
+			errs.add("LogFile is required")
+		}
+	case logTargetStdout:
+	case logTargetSyslog:
+		if _, _, err := parseSyslogAddr(c.SyslogAddr); err != nil {
+			errs.add("%v", err)
+		}
+	default:
+		errs.add("LogTarget %q is not supported, use \"file\", \"stdout\" or \"syslog\"", c.LogTarget)
+	}
+	if c.AccessLogFile != "" && c.AccessLogFile == c.LogFile && c.logTarget() == logTargetFile {
+		errs.add("AccessLogFile must differ from LogFile, leave it empty to share the file")
+	}
+
+	// ACME 模式下证书自动申请，Unix 套接字不使用 TLS，都不需要证书文件
+	_, unixSocket := c.unixSocketPath()
+	if unixSocket {
+		if len(c.ACMEDomains) > 0 || c.EnableHTTP3 {
+			errs.add("ACMEDomains and EnableHTTP3 cannot be used with a unix socket ListenAddr")
+		}
+	} else if len(c.ACMEDomains) == 0 {
+		checkReadable(&errs, "CertFile", c.CertFile)
+		checkReadable(&errs, "KeyFile", c.KeyFile)
+	}
+
+	if c.HTTPListenAddr != "" {
+		if c.HTTPListenAddr == c.listenAddr() || c.HTTPListenAddr == c.HTTPRedirectAddr {
+			errs.add("HTTPListenAddr %q must differ from ListenAddr and HTTPRedirectAddr", c.HTTPListenAddr)
+		}
+		// 明文连接没有客户端证书，会绕过双向 TLS
+		if c.RequireClientCert {
+			errs.add("HTTPListenAddr cannot be used with RequireClientCert")
+		}
+	}
+
+	minVersion, err := parseTLSVersion(c.TLSMinVersion, 0)
+	if err != nil {
+		errs.add("TLSMinVersion: %v", err)
+	}
+	maxVersion, err := parseTLSVersion(c.TLSMaxVersion, 0)
+	if err != nil {
+		errs.add("TLSMaxVersion: %v", err)
+	}
+	if minVersion != 0 && maxVersion != 0 && minVersion > maxVersion {
+		errs.add("TLSMinVersion %s is higher than TLSMaxVersion %s", c.TLSMinVersion, c.TLSMaxVersion)
+	}
+	if _, err := parseCipherSuites(c.CipherSuites); err != nil {
+		errs.add("CipherSuites: %v", err)
+	}
+
+	if c.RequireClientCert && c.ClientCAFile == "" {
+		errs.add("RequireClientCert needs ClientCAFile")
+	} else if c.ClientCAFile != "" {
+		checkReadable(&errs, "ClientCAFile", c.ClientCAFile)
+	}
+
+	switch c.LogFormat {
+	case "", "text", "json", "combined":
+	default:
+		errs.add("LogFormat %q is not supported, use \"text\", \"json\" or \"combined\"", c.LogFormat)
+	}
+	switch c.Stickiness {
+	case "", stickyIP, stickyCookie, stickyHash:
+	default:
+		errs.add("Stickiness %q is not supported, use \"ip\", \"cookie\" or \"consistent-hash\"", c.Stickiness)
+	}
+	if c.CORS.AllowCredentials && slices.Contains(c.CORS.AllowedOrigins, "*") {
+		// "*" 会回显任意 Origin，再允许凭据就等于任何网站都能读取带 Cookie 的响应
+		errs.add("CORS.AllowCredentials cannot be used with AllowedOrigins \"*\", list the allowed origins explicitly")
+	}
+	if c.EnableProxyProtocol && len(c.TrustedProxies) == 0 {
+		// 否则任何能直连端口的客户端都可以用伪造的协议头指定自己的地址
+		errs.add("EnableProxyProtocol requires TrustedProxies")
+	}
+	if c.HashKeyHeader != "" && c.Stickiness != stickyHash {
+		errs.add("HashKeyHeader requires Stickiness \"consistent-hash\"")
+	}
+	if _, err := newIPACL(c.AllowCIDRs, c.DenyCIDRs); err != nil {
+		errs.add("AllowCIDRs/DenyCIDRs: %v", err)
+	}
+	if c.MaxRetries < 0 {
+		errs.add("MaxRetries must not be negative")
+	}
+	for _, code := range c.RetryOnStatus {
+		if code < 500 || code > 599 {
+			errs.add("RetryOnStatus %d must be a 5xx status code", code)
+		}
+	}
+	if c.LogMaxSizeMB < 0 || c.LogMaxBackups < 0 {
+		errs.add("LogMaxSizeMB and LogMaxBackups must not be negative")
+	}
+	if c.LogSampleRate != nil && (*c.LogSampleRate < 0 || *c.LogSampleRate > 1) {
+		errs.add("LogSampleRate must be between 0 and 1")
+	}
+	if _, err := newJWTVerifier(c.JWTAuth); err != nil {
+		errs.add("JWTAuth: %v", err)
+	}
+	if c.EnablePprof && c.AdminToken == "" {
+		errs.add("EnablePprof requires AdminToken")
+	}
+	if c.AdminReloadPath != "" && c.AdminToken == "" {
+		errs.add("AdminReloadPath requires AdminToken")
+	}
+	if c.AdminConfigPath != "" && c.AdminToken == "" {
+		errs.add("AdminConfigPath requires AdminToken")
+	}
+	if c.AdminDrainPath != "" && c.AdminToken == "" {
+		errs.add("AdminDrainPath requires AdminToken")
+	}
+	if c.BasicAuthUser != "" && c.BasicAuthPass == "" {
+		errs.add("BasicAuthPass is required when BasicAuthUser is set")
+	}
+	if c.HealthCheckPath != "" && !strings.HasPrefix(c.HealthCheckPath, "/") {
+		errs.add("HealthCheckPath %q must start with /", c.HealthCheckPath)
+	}
+	if c.OTLPEndpoint != "" {
+		if u, err := url.Parse(c.OTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs.add("OTLPEndpoint %q must be an http:// or https:// URL", c.OTLPEndpoint)
+		}
+	}
+	if c.CanaryTarget != "" {
+		checkTarget(&errs, c.CanaryTarget)
+		if c.CanaryHeader == "" && c.CanaryPercent == 0 {
+			errs.add("CanaryHeader or CanaryPercent is required when CanaryTarget is set")
+		}
+	}
+	if c.CanaryPercent < 0 || c.CanaryPercent > 100 {
+		errs.add("CanaryPercent must be between 0 and 100")
+	}
+	if c.UpstreamCAFile != "" {
+		if _, err := upstreamTLSConfig(c); err != nil {
+			errs.add("UpstreamCAFile: %v", err)
+		}
+	}
+	if c.RpAddrBackup != "" {
+		checkTarget(&errs, c.RpAddrBackup)
+	}
+	if c.MaxHeaderBytes < 0 {
+		errs.add("MaxHeaderBytes must not be negative")
+	}
+	if c.MaxBackendRedirects < 0 {
+		errs.add("MaxBackendRedirects must not be negative")
+	}
+	for i, rule := range c.ResponseRewrite {
+		if rule.From == "" {
+			errs.add("ResponseRewrite[%d].From must not be empty", i)
+		}
+	}
+	if c.GeoDBPath != "" {
+		checkReadable(&errs, "GeoDBPath", c.GeoDBPath)
+	} else if len(c.AllowedCountries) > 0 || len(c.BlockedCountries) > 0 {
+		errs.add("AllowedCountries and BlockedCountries require GeoDBPath")
+	}
+	for _, code := range append(c.AllowedCountries[:len(c.AllowedCountries):len(c.AllowedCountries)], c.BlockedCountries...) {
+		if len(strings.TrimSpace(code)) != 2 {
+			errs.add("country code %q must be a two-letter ISO 3166-1 code", code)
+		}
+	}
+	if c.LogBufferSize < 0 {
+		errs.add("LogBufferSize must not be negative")
+	}
+	if c.MaxConnsPerIP < 0 {
+		errs.add("MaxConnsPerIP must not be negative")
+	}
+	if c.MaxConcurrentRequests < 0 {
+		errs.add("MaxConcurrentRequests must not be negative")
+	}
+	if c.CacheMaxEntries < 0 {
+		errs.add("CacheMaxEntries must not be negative")
+	}
+	if c.CircuitBreakerFailures < 0 {
+		errs.add("CircuitBreakerFailures must not be negative")
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// checkTarget 检查代理目标是带 http/https 协议和主机名的 URL，或 unix: 开头的 Unix 套接字路径
+func checkTarget(errs *configErrors, addr string) {
+	if path, ok := strings.CutPrefix(addr, unixTargetPrefix); ok {
+		if path == "" {
+			errs.add("proxy target %q has no socket path", addr)
+		}
+		return
+	}
+	u, err := url.Parse(addr)
+	switch {
+	case err != nil:
+		errs.add("proxy target %q is not a valid URL: %v", addr, err)
+	case u.Scheme != "http" && u.Scheme != "https":
+		errs.add("proxy target %q must use http:// or https:// scheme", addr)
+	case u.Host == "":
+		errs.add("proxy target %q has no host", addr)
+	}
+}
+
+// checkReadable 检查必填的文件路径存在且可读
+func checkReadable(errs *configErrors, field, path string) {
+	if path == "" {
+		errs.add("%s is required", field)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		errs.add("%s %q is not readable: %v", field, path, err)
+		return
+	}
+	f.Close()
+}